@@ -0,0 +1,155 @@
+package cloudflarelogs
+
+import (
+	"fmt"
+	"github.com/blockpane/logsuck/internal/flatten"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	auditPath    = "/accounts/%s/audit_logs"
+	auditPerPage = 100
+)
+
+// AuditLog is a single entry from the accounts/:id/audit_logs endpoint, as sent by cloudflare.
+type AuditLog struct {
+	Id     string `json:"id"`
+	Action struct {
+		Info   string `json:"info"`
+		Result bool   `json:"result"`
+		Type   string `json:"type"`
+	} `json:"action"`
+	Actor struct {
+		Email string `json:"email"`
+		Id    string `json:"id"`
+		Ip    string `json:"ip"`
+		Type  string `json:"type"`
+	} `json:"actor"`
+	Interface string                 `json:"interface"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	NewValue  string                 `json:"newValue"`
+	OldValue  string                 `json:"oldValue"`
+	Owner     struct {
+		Id string `json:"id"`
+	} `json:"owner"`
+	Resource struct {
+		Id   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"resource"`
+	When time.Time `json:"when"`
+}
+
+// AuditEvent is the flattened version of an AuditLog that gets printed.
+type AuditEvent struct {
+	Id             string            `json:"id"`
+	When           time.Time         `json:"when"`
+	Interface      string            `json:"interface,omitempty"`
+	ActorEmail     string            `json:"actor_email,omitempty"`
+	ActorId        string            `json:"actor_id,omitempty"`
+	ActorIp        net.IP            `json:"actor_ip,omitempty"`
+	ActorIpVersion int               `json:"actor_ip_version,omitempty"`
+	ActorType      string            `json:"actor_type,omitempty"`
+	ActionType     string            `json:"action_type,omitempty"`
+	ActionInfo     string            `json:"action_info,omitempty"`
+	ActionResult   bool              `json:"action_result"`
+	ResourceId     string            `json:"resource_id,omitempty"`
+	ResourceType   string            `json:"resource_type,omitempty"`
+	OwnerId        string            `json:"owner_id,omitempty"`
+	OldValue       string            `json:"old_value,omitempty"`
+	NewValue       string            `json:"new_value,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Flatten converts an AuditLog into a single level AuditEvent, nested metadata keys are joined with a '.'
+func (a AuditLog) Flatten() AuditEvent {
+	e := AuditEvent{
+		Id:           a.Id,
+		When:         a.When,
+		Interface:    a.Interface,
+		ActorEmail:   a.Actor.Email,
+		ActorId:      a.Actor.Id,
+		ActorIp:      ipaddr.Parse(a.Actor.Ip),
+		ActorType:    a.Actor.Type,
+		ActionType:   a.Action.Type,
+		ActionInfo:   a.Action.Info,
+		ActionResult: a.Action.Result,
+		ResourceId:   a.Resource.Id,
+		ResourceType: a.Resource.Type,
+		OwnerId:      a.Owner.Id,
+		OldValue:     a.OldValue,
+		NewValue:     a.NewValue,
+	}
+	e.ActorIpVersion = ipaddr.Version(e.ActorIp)
+	if len(a.Metadata) > 0 {
+		e.Metadata = make(map[string]string)
+		flatten.Map("", a.Metadata, e.Metadata)
+	}
+	return e
+}
+
+// AuditResponse is a single page of audit logs
+type AuditResponse struct {
+	Result     []AuditLog
+	ResultInfo ResultInfo
+}
+
+// More reports if another page should be requested.
+func (r AuditResponse) More() bool {
+	return r.ResultInfo.More(len(r.Result), auditPerPage)
+}
+
+// NewAuditQuery builds the query string for a page of audit logs between since and before.
+func NewAuditQuery(since time.Time, before time.Time, page int) url.Values {
+	v := url.Values{}
+	v.Set("since", since.UTC().Format(time.RFC3339))
+	v.Set("before", before.UTC().Format(time.RFC3339))
+	v.Set("direction", "asc")
+	v.Set("page", strconv.Itoa(page))
+	v.Set("per_page", strconv.Itoa(auditPerPage))
+	return v
+}
+
+// AuditLogs requests a single page of audit logs.
+func (c *Client) AuditLogs(account string, query url.Values) (*AuditResponse, error) {
+	page := &AuditResponse{}
+	response, err := c.getApi(fmt.Sprintf(auditPath, url.PathEscape(account)), query, &page.Result)
+	if err != nil {
+		return nil, err
+	}
+	page.ResultInfo = response.ResultInfo
+	return page, nil
+}
+
+// CollectAuditLogs calls emit for each account audit log entry since the checkpoint that wasn't already emitted, and
+// returns the new checkpoint, which is still valid if an error is also returned.
+func (c *Client) CollectAuditLogs(account string, cp Checkpoint, emit func(AuditEvent) error) (Checkpoint, error) {
+	since := cp.Last
+	before := c.Now().UTC().Truncate(time.Second)
+	if since.After(before) {
+		return cp, nil
+	}
+	skip := cp.skip()
+	for page := 1; ; page++ {
+		response, err := c.AuditLogs(account, NewAuditQuery(since, before, page))
+		if err != nil {
+			return cp, err
+		}
+		for _, a := range response.Result {
+			id := eventId(a.Id)
+			if skip(a.When, id) {
+				continue
+			}
+			if err = emit(a.Flatten()); err != nil {
+				return cp, err
+			}
+			cp.add(a.When, id)
+		}
+		if !response.More() {
+			return cp, nil
+		}
+	}
+}
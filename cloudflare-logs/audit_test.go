@@ -0,0 +1,41 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var rawAudit = `{"id":"f174be97-19b1-40d6-954d-70cd5fbd52db","action":{"info":"","result":true,"type":"rec_set"},"actor":{"email":"user@example.com","id":"f6b5de0326bb5182b8a4840ee01ec774","ip":"198.41.129.166","type":"user"},"interface":"API","metadata":{"name":"www.example.com","type":"A","ttl":1,"proxied":true,"zone":{"id":"023e105f4ecef8ad9ca31a8372d0c353"}},"newValue":"","oldValue":"","owner":{"id":"023e105f4ecef8ad9ca31a8372d0c353"},"resource":{"id":"023e105f4ecef8ad9ca31a8372d0c353","type":"DNS_record"},"when":"2017-04-26T17:31:07Z"}`
+
+func TestAuditLogFlatten(t *testing.T) {
+	a := AuditLog{}
+	if err := json.Unmarshal([]byte(rawAudit), &a); err != nil {
+		t.Fatal(err)
+	}
+	e := a.Flatten()
+	if e.ActorEmail != "user@example.com" || e.ActionType != "rec_set" || e.ResourceType != "DNS_record" {
+		t.Errorf("unexpected flattened event: %+v", e)
+	}
+	if e.ActorIp.String() != "198.41.129.166" {
+		t.Errorf("expected actor ip to be parsed, got %v", e.ActorIp)
+	}
+	if e.Metadata["zone.id"] != "023e105f4ecef8ad9ca31a8372d0c353" || e.Metadata["proxied"] != "true" || e.Metadata["ttl"] != "1" {
+		t.Errorf("unexpected metadata: %+v", e.Metadata)
+	}
+}
+
+func TestAuditResponseMore(t *testing.T) {
+	r := AuditResponse{}
+	r.ResultInfo.Page, r.ResultInfo.TotalPages = 1, 2
+	if !r.More() {
+		t.Error("expected more pages")
+	}
+	r.ResultInfo.Page = 2
+	if r.More() {
+		t.Error("did not expect more pages")
+	}
+	r = AuditResponse{Result: make([]AuditLog, auditPerPage)}
+	if !r.More() {
+		t.Error("expected a full page without result_info to request another")
+	}
+}
@@ -0,0 +1,57 @@
+package cloudflarelogs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// maxSeen caps the ids kept for one second, so the checkpoint fits in a standard SSM parameter. Past that, events in
+// the checkpoint's second can be printed twice, but none are lost.
+const maxSeen = 200
+
+// Checkpoint records how far a collector has read. Last is the newest second that events were emitted for and Seen
+// the ids of the events emitted in it. Queries start at Last rather than the second after, since more events for that
+// second can turn up later or be left on a page that wasn't finished, and skip anything in Seen.
+type Checkpoint struct {
+	Last time.Time `json:"last"`
+	Seen []string  `json:"seen,omitempty"`
+}
+
+// add records an emitted event, moving Last forward if it is in a later second
+func (c *Checkpoint) add(when time.Time, id string) {
+	when = when.UTC().Truncate(time.Second)
+	switch {
+	case when.After(c.Last):
+		c.Last = when
+		c.Seen = []string{id}
+	case when.Equal(c.Last):
+		for _, s := range c.Seen {
+			if s == id {
+				return
+			}
+		}
+		if len(c.Seen) < maxSeen {
+			c.Seen = append(c.Seen, id)
+		}
+	}
+}
+
+// skip returns a test for events that were already emitted, it only looks at events in the Last second.
+func (c Checkpoint) skip() func(when time.Time, id string) bool {
+	seen := make(map[string]bool)
+	for _, s := range c.Seen {
+		seen[s] = true
+	}
+	last := c.Last
+	return func(when time.Time, id string) bool {
+		return when.UTC().Truncate(time.Second).Equal(last) && seen[id]
+	}
+}
+
+// eventId is a short digest of the fields that identify an event, kept short to fit more in a checkpoint.
+func eventId(fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,159 @@
+package cloudflarelogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultBaseURL is the cloudflare v4 API, the GraphQL endpoint lives below it.
+const DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+
+// Client holds everything needed to talk to the cloudflare API. BaseURL, HTTPClient and Now can be replaced,
+// for example to point at a test server with a fixed clock.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Now        func() time.Time
+
+	email string
+	key   string
+}
+
+// NewClient returns a Client using the global API key auth headers.
+func NewClient(email string, key string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		HTTPClient: &http.Client{Timeout: time.Second * 10},
+		Now:        time.Now,
+		email:      email,
+		key:        key,
+	}
+}
+
+// newRequest builds a request for the cloudflare API with the auth headers set.
+func (c *Client) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Email", c.email)
+	req.Header.Set("X-Auth-Key", c.key)
+	return req, nil
+}
+
+// do sends the request and returns the body.
+func (c *Client) do(req *http.Request) (status int, body []byte, err error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body, err
+}
+
+// ApiResponse is the envelope returned by the cloudflare v4 REST API
+type ApiResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo ResultInfo      `json:"result_info"`
+}
+
+// ResultInfo holds the paging details of a REST API response
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+// More reports if another page should be requested, not every endpoint returns total_pages so a full page
+// is also treated as a reason to keep going.
+func (r ResultInfo) More(results int, perPage int) bool {
+	if r.TotalPages > 0 {
+		return r.Page < r.TotalPages
+	}
+	return results >= perPage
+}
+
+// getApi performs a GET against the REST API and unmarshals the result into out.
+func (c *Client) getApi(path string, query url.Values, out interface{}) (*ApiResponse, error) {
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := c.newRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	status, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	response := &ApiResponse{}
+	err = json.Unmarshal(body, response)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode response (status %d): %v", status, err)
+	}
+	if !response.Success {
+		if len(response.Errors) > 0 {
+			return nil, fmt.Errorf("cloudflare api error %d: %s", response.Errors[0].Code, response.Errors[0].Message)
+		}
+		return nil, fmt.Errorf("cloudflare api request failed with status %d", status)
+	}
+	if len(response.Result) > 0 && out != nil {
+		if err = json.Unmarshal(response.Result, out); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// GraphRequest is a GraphQL query and its variables.
+type GraphRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// postGraphQL sends a query to the GraphQL endpoint and unmarshals the data in the response into out.
+func (c *Client) postGraphQL(gq interface{}, out interface{}) error {
+	query, err := json.Marshal(gq)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest("POST", "/graphql/", bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	status, body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	response := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("could not decode graphql response (status %d): %v", status, err)
+	}
+	if len(response.Errors) > 0 {
+		return fmt.Errorf("cloudflare graphql error: %s", response.Errors[0].Message)
+	}
+	if len(response.Data) == 0 || string(response.Data) == "null" {
+		return fmt.Errorf("cloudflare graphql response had no data (status %d)", status)
+	}
+	return json.Unmarshal(response.Data, out)
+}
@@ -0,0 +1,197 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2021, 1, 19, 12, 0, 0, 0, time.UTC)
+
+// newTestClient returns a Client pointed at a test server with a fixed clock.
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Email") != "user@example.com" || r.Header.Get("X-Auth-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	c := NewClient("user@example.com", "key")
+	c.BaseURL = srv.URL
+	c.HTTPClient = srv.Client()
+	c.Now = func() time.Time { return testNow }
+	return c
+}
+
+// graphqlFirewall is a stand-in for the GraphQL API that serves firewall events from a fixed list, honoring the
+// datetime filter and limit the same way the real API does.
+func graphqlFirewall(t *testing.T, events []Event, queries *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*queries += 1
+		if r.Method != "POST" || r.URL.Path != "/graphql/" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		gq := GraphQuery{}
+		if err := json.NewDecoder(r.Body).Decode(&gq); err != nil {
+			t.Fatal(err)
+		}
+		geq, _ := time.Parse(time.RFC3339, gq.Variables.Filter.DatetimeGeq)
+		leq, _ := time.Parse(time.RFC3339, gq.Variables.Filter.DatetimeLeq)
+		if leq.Sub(geq) >= 24*time.Hour {
+			t.Errorf("query window is more than a day: %s - %s", geq, leq)
+		}
+		found := make([]Event, 0)
+		for _, e := range events {
+			if !e.Date.Before(geq) && !e.Date.After(leq) && len(found) < FirewallLimit {
+				found = append(found, e)
+			}
+		}
+		resp := Response{}
+		resp.Data.Viewer.Zones = append(resp.Data.Viewer.Zones, struct {
+			Events []Event `json:"firewallEventsAdaptive"`
+		}{found})
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func testEvents(start time.Time, n int, interval time.Duration) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{
+			Action: "block",
+			Ip:     net.ParseIP("22.22.222.22"),
+			Date:   start.Add(time.Duration(i) * interval),
+			Ray:    fmt.Sprintf("ray%d", i),
+		}
+	}
+	return events
+}
+
+func TestCollectFirewallEvents(t *testing.T) {
+	events := testEvents(testNow.Add(-90*time.Minute), 150, 30*time.Second)
+	queries := 0
+	c := newTestClient(t, graphqlFirewall(t, events, &queries))
+
+	got := make([]Event, 0)
+	last, err := c.CollectFirewallEvents("zone", testNow.Add(-2*time.Hour), func(e Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("expected %d events, got %d", len(events), len(got))
+	}
+	for i := range got {
+		if got[i].Ray != events[i].Ray {
+			t.Fatalf("events out of order at %d: %s != %s", i, got[i].Ray, events[i].Ray)
+		}
+	}
+	if !last.Equal(events[len(events)-1].Date) {
+		t.Errorf("expected checkpoint at the last event %s, got %s", events[len(events)-1].Date, last)
+	}
+	if queries != 3 {
+		t.Errorf("expected 3 queries (two full pages and an empty one), got %d", queries)
+	}
+}
+
+func TestCollectFirewallEventsEmptyWindows(t *testing.T) {
+	events := testEvents(testNow.Add(-6*time.Hour), 1, time.Second)
+	queries := 0
+	c := newTestClient(t, graphqlFirewall(t, events, &queries))
+
+	count := 0
+	last, err := c.CollectFirewallEvents("zone", testNow.Add(-72*time.Hour), func(e Event) error {
+		count += 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the event after two empty days to be found, got %d events", count)
+	}
+	if !last.Equal(events[0].Date) {
+		t.Errorf("expected checkpoint %s, got %s", events[0].Date, last)
+	}
+}
+
+func TestCollectFirewallEventsError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":null,"errors":[{"message":"zone not found"}]}`))
+	})
+	start := testNow.Add(-time.Hour)
+	last, err := c.CollectFirewallEvents("zone", start, func(e Event) error { return nil })
+	if err == nil {
+		t.Error("expected graphql error to be returned")
+	}
+	if !last.Equal(start) {
+		t.Errorf("checkpoint should not move on error, got %s", last)
+	}
+
+	c.key = "wrong"
+	if _, err = c.FirewallEvents("zone", start, testNow); err == nil {
+		t.Error("expected an error with bad credentials")
+	}
+}
+
+func TestCollectAuditLogs(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/accounts/acct/audit_logs" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		page := r.URL.Query().Get("page")
+		fmt.Fprintf(w, `{"success":true,"errors":[],"result":[{"id":"%s","action":{"type":"rec_set","result":true},"actor":{"email":"user@example.com"},"when":"2021-01-19T11:0%s:00Z"}],"result_info":{"page":%s,"total_pages":2}}`, page, page, page)
+	})
+	ids := make([]string, 0)
+	cp, err := c.CollectAuditLogs("acct", Checkpoint{Last: testNow.Add(-time.Hour)}, func(e AuditEvent) error {
+		ids = append(ids, e.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("expected both pages, got %v", ids)
+	}
+	if !cp.Last.Equal(time.Date(2021, 1, 19, 11, 2, 0, 0, time.UTC)) || len(cp.Seen) != 1 || cp.Seen[0] != eventId("2") {
+		t.Errorf("unexpected checkpoint %+v", cp)
+	}
+}
+
+func TestCollectAuditLogsSameSecond(t *testing.T) {
+	var since string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		since = r.URL.Query().Get("since")
+		// "a" was emitted by the last run, "b" turned up later with the same timestamp
+		fmt.Fprint(w, `{"success":true,"errors":[],"result":[`+
+			`{"id":"a","when":"2021-01-19T11:00:00Z"},{"id":"b","when":"2021-01-19T11:00:00.5Z"},{"id":"c","when":"2021-01-19T11:00:01Z"}`+
+			`],"result_info":{"page":1,"total_pages":1}}`)
+	})
+	last := time.Date(2021, 1, 19, 11, 0, 0, 0, time.UTC)
+	ids := make([]string, 0)
+	cp, err := c.CollectAuditLogs("acct", Checkpoint{Last: last, Seen: []string{eventId("a")}}, func(e AuditEvent) error {
+		ids = append(ids, e.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if since != last.Format(time.RFC3339) {
+		t.Errorf("expected the query to start at the checkpoint's second, got %s", since)
+	}
+	if len(ids) != 2 || ids[0] != "b" || ids[1] != "c" {
+		t.Errorf("expected only the events that weren't emitted yet, got %v", ids)
+	}
+	if !cp.Last.Equal(last.Add(time.Second)) || len(cp.Seen) != 1 {
+		t.Errorf("unexpected checkpoint %+v", cp)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	cloudflarelogs "github.com/blockpane/logsuck/cloudflare-logs"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+var (
+	cfg        cloudflarelogs.Config
+	normalizer *cloudflarelogs.Normalizer // nil unless OUTPUT=normalized
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.LUTC)
+	var err error
+	normalizer, err = cloudflarelogs.NewNormalizer(os.Getenv("OUTPUT"), os.Getenv("GEOIP_DB"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg = cloudflarelogs.ConfigFromEnv()
+
+	switch os.Getenv("SOURCE") {
+	case "audit":
+		lambda.Start(HandleAudit)
+	case "access":
+		lambda.Start(HandleAccess)
+	case "gateway":
+		lambda.Start(HandleGateway)
+	case "logpush-s3":
+		lambda.Start(HandleLogpushS3)
+	case "logpush-http":
+		startReceiver()
+	default:
+		lambda.Start(HandleFirewall)
+	}
+}
+
+// HandleFirewall prints firewall events for the zone.
+func HandleFirewall() error {
+	return collect(cfg.TimeParameter, cfg.ZoneParameter, func(c *cloudflarelogs.Client, zone string, last time.Time) (time.Time, error) {
+		return c.CollectFirewallEvents(zone, last, func(e cloudflarelogs.Event) error {
+			return printJSON(normalizer.Output(e))
+		})
+	})
+}
+
+// HandleAudit prints account audit logs.
+func HandleAudit() error {
+	return collectCheckpoint(cfg.AuditTimeParameter, cfg.AccountParameter, func(c *cloudflarelogs.Client, account string, cp cloudflarelogs.Checkpoint) (cloudflarelogs.Checkpoint, error) {
+		return c.CollectAuditLogs(account, cp, func(e cloudflarelogs.AuditEvent) error {
+			return printJSON(e)
+		})
+	})
+}
+
+// HandleAccess prints Access authentication events.
+func HandleAccess() error {
+	return collectCheckpoint(cfg.AccessTimeParameter, cfg.AccountParameter, func(c *cloudflarelogs.Client, account string, cp cloudflarelogs.Checkpoint) (cloudflarelogs.Checkpoint, error) {
+		return c.CollectAccessLogs(account, cp, func(e cloudflarelogs.ZeroTrustEvent) error {
+			return printJSON(e)
+		})
+	})
+}
+
+// HandleGateway prints Gateway DNS and HTTP activity, each has its own checkpoint.
+func HandleGateway() error {
+	for kind, timeParam := range map[string]string{
+		cloudflarelogs.GatewayDns:  cfg.GatewayDnsTimeParameter,
+		cloudflarelogs.GatewayHttp: cfg.GatewayHttpTimeParameter,
+	} {
+		kind := kind
+		err := collectCheckpoint(timeParam, cfg.AccountParameter, func(c *cloudflarelogs.Client, account string, cp cloudflarelogs.Checkpoint) (cloudflarelogs.Checkpoint, error) {
+			return c.CollectGatewayLogs(account, kind, cp, func(e cloudflarelogs.ZeroTrustEvent) error {
+				return printJSON(e)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleLogpushS3 prints the records in Logpush files as they land in S3.
+func HandleLogpushS3(ctx context.Context, event events.S3Event) error {
+	awsSession, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(cfg.Region),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	return cloudflarelogs.HandleS3Event(ctx, s3.New(awsSession), event, os.Getenv("LOGPUSH_DATASET"), printLogpush)
+}
+
+// startReceiver runs the Logpush HTTP receiver, either standalone if LISTEN_ADDR is set, or as a Lambda handler.
+func startReceiver() {
+	secret := os.Getenv("LOGPUSH_SECRET")
+	if secret == "" {
+		ps, err := cloudflarelogs.NewParamStore(cfg.Region)
+		if err != nil {
+			log.Fatal(err)
+		}
+		secret, err = ps.Get(cfg.LogpushSecretParameter, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	receiver, err := cloudflarelogs.NewLogpushReceiver(os.Getenv("LOGPUSH_SECRET_HEADER"), secret, printLogpush)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		log.Println("logpush receiver listening on", addr)
+		log.Fatal(http.ListenAndServe(addr, receiver))
+	}
+	lambda.Start(receiver.HandleRequest)
+}
+
+// setup loads the credentials and the zone or account id in idParam.
+func setup(idParam string) (ps *cloudflarelogs.ParamStore, c *cloudflarelogs.Client, id string, err error) {
+	ps, err = cloudflarelogs.NewParamStore(cfg.Region)
+	if err != nil {
+		return
+	}
+	values, err := ps.Required(cfg.EmailParameter, cfg.KeyParameter, idParam)
+	if err != nil {
+		return
+	}
+	return ps, cloudflarelogs.NewClient(values[0], values[1]), values[2], nil
+}
+
+// collect loads the checkpoint time in timeParam and runs the collector. The checkpoint it returns is saved even if it
+// failed part way through.
+func collect(timeParam string, idParam string, run func(c *cloudflarelogs.Client, id string, last time.Time) (time.Time, error)) error {
+	ps, c, id, err := setup(idParam)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	last, err := ps.GetTime(timeParam)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	newLast, err := run(c, id, last)
+	if err != nil {
+		log.Println(err)
+	}
+	if saveErr := ps.SaveTime(timeParam, newLast); saveErr != nil {
+		log.Println(saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+// collectCheckpoint is collect for collectors that keep a Checkpoint.
+func collectCheckpoint(cpParam string, idParam string, run func(c *cloudflarelogs.Client, id string, cp cloudflarelogs.Checkpoint) (cloudflarelogs.Checkpoint, error)) error {
+	ps, c, id, err := setup(idParam)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	cp, err := ps.GetCheckpoint(cpParam)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	cp, err = run(c, id, cp)
+	if err != nil {
+		log.Println(err)
+	}
+	if saveErr := ps.SaveCheckpoint(cpParam, cp); saveErr != nil {
+		log.Println(saveErr)
+		if err == nil {
+			err = saveErr
+		}
+	}
+	return err
+}
+
+func printLogpush(e cloudflarelogs.LogpushEvent) error {
+	return printJSON(normalizer.OutputLogpush(e))
+}
+
+func printJSON(v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(j))
+	return nil
+}
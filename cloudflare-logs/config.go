@@ -0,0 +1,49 @@
+package cloudflarelogs
+
+import (
+	"os"
+)
+
+// Config holds the names of the SSM parameters used for settings and checkpoints.
+type Config struct {
+	Region                   string
+	EmailParameter           string
+	KeyParameter             string
+	ZoneParameter            string
+	AccountParameter         string
+	TimeParameter            string
+	AuditTimeParameter       string
+	AccessTimeParameter      string
+	GatewayDnsTimeParameter  string
+	GatewayHttpTimeParameter string
+	LogpushSecretParameter   string
+}
+
+// ConfigFromEnv reads environment variables, and if missing returns sensible defaults.
+func ConfigFromEnv() Config {
+	c := Config{
+		Region:                   os.Getenv("AWS_REGION"),
+		EmailParameter:           os.Getenv("SSM_EMAIL"),
+		KeyParameter:             os.Getenv("SSM_KEY"),
+		ZoneParameter:            envDefault("SSM_ZONE", "/cloudflare/zone"),
+		AccountParameter:         envDefault("SSM_ACCOUNT", "/cloudflare/account"),
+		TimeParameter:            envDefault("SSM_TIMESTAMP", "/cloudflare/last"),
+		AuditTimeParameter:       envDefault("SSM_AUDIT_TIMESTAMP", "/cloudflare/audit_last"),
+		AccessTimeParameter:      envDefault("SSM_ACCESS_TIMESTAMP", "/cloudflare/access_last"),
+		GatewayDnsTimeParameter:  envDefault("SSM_GATEWAY_DNS_TIMESTAMP", "/cloudflare/gateway_dns_last"),
+		GatewayHttpTimeParameter: envDefault("SSM_GATEWAY_HTTP_TIMESTAMP", "/cloudflare/gateway_http_last"),
+		LogpushSecretParameter:   envDefault("SSM_LOGPUSH_SECRET", "/cloudflare/logpush_secret"),
+	}
+	if c.EmailParameter == "" || c.KeyParameter == "" {
+		c.EmailParameter = "/cloudflare/email"
+		c.KeyParameter = "/cloudflare/key"
+	}
+	return c
+}
+
+func envDefault(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
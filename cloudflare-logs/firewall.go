@@ -0,0 +1,139 @@
+package cloudflarelogs
+
+import (
+	"net"
+	"time"
+)
+
+const (
+	// FirewallLimit is the most events returned by a single firewall events query
+	FirewallLimit = 100
+
+	q = `query ListFirewallEvents($zoneTag: string, $filter: FirewallEventsAdaptiveFilter_InputObject) {
+          viewer {
+          zones(filter: { zoneTag: $zoneTag }) {
+            firewallEventsAdaptive(
+              filter: $filter
+              limit: 100
+              orderBy: [datetime_ASC]
+            ) {
+              action
+              clientASNDescription
+              clientAsn
+              clientCountryName
+              clientIP
+              clientRequestHTTPHost
+              clientRequestHTTPMethodName
+              clientRequestHTTPProtocol
+              clientRequestPath
+              clientRequestQuery
+              datetime
+              rayName
+              ruleId
+              source
+              userAgent
+            }
+          }
+        }
+      }`
+)
+
+// GraphQuery is the GraphQL request for firewall events in a zone
+type GraphQuery struct {
+	Query     string `json:"query"`
+	Variables struct {
+		ZoneTag string `json:"zoneTag"`
+		Filter  struct {
+			DatetimeGeq string `json:"datetime_geq"`
+			DatetimeLeq string `json:"datetime_leq"`
+		} `json:"filter"`
+	} `json:"variables"`
+}
+
+// NewQuery builds a firewall events query for the time range, both ends are inclusive.
+func NewQuery(start time.Time, end time.Time, zone string) GraphQuery {
+	gq := GraphQuery{Query: q}
+	gq.Variables.Filter.DatetimeGeq = start.UTC().Format("2006-01-02T15:04:05Z")
+	gq.Variables.Filter.DatetimeLeq = end.UTC().Format("2006-01-02T15:04:05Z")
+	gq.Variables.ZoneTag = zone
+	return gq
+}
+
+// Event is a single firewall event
+type Event struct {
+	Action    string    `json:"action"`
+	AsnDesc   string    `json:"clientASNDescription"`
+	Asn       string    `json:"clientAsn"`
+	Country   string    `json:"clientCountryName"`
+	Ip        net.IP    `json:"clientIP"`
+	Host      string    `json:"clientRequestHTTPHost"`
+	Method    string    `json:"clientRequestHTTPMethodName"`
+	Proto     string    `json:"clientRequestHTTPProtocol"`
+	Path      string    `json:"clientRequestPath"`
+	Query     string    `json:"clientRequestQuery"`
+	Date      time.Time `json:"datetime"`
+	Ray       string    `json:"rayName"`
+	Rule      string    `json:"ruleId"`
+	Source    string    `json:"source"`
+	UserAgent string    `json:"userAgent"`
+}
+
+// Response is the GraphQL response to a GraphQuery
+type Response struct {
+	Data struct {
+		Viewer struct {
+			Zones []struct {
+				Events []Event `json:"firewallEventsAdaptive"`
+			} `json:"zones"`
+		} `json:"viewer"`
+	} `json:"data"`
+}
+
+// FirewallEvents returns up to FirewallLimit events for the zone between start and end.
+func (c *Client) FirewallEvents(zone string, start time.Time, end time.Time) ([]Event, error) {
+	response := &Response{}
+	gq := NewQuery(start, end, zone)
+	if err := c.postGraphQL(&gq, &response.Data); err != nil {
+		return nil, err
+	}
+	if len(response.Data.Viewer.Zones) == 0 {
+		return nil, nil
+	}
+	return response.Data.Viewer.Zones[0].Events, nil
+}
+
+// CollectFirewallEvents calls emit for every event after last, working forward in windows of up to a day (the
+// most the API allows). It returns the new checkpoint, which is still valid if an error is also returned.
+func (c *Client) CollectFirewallEvents(zone string, last time.Time, emit func(Event) error) (time.Time, error) {
+	for {
+		now := c.Now()
+		until := last.Add(86399 * time.Second) // 86400 max, take one away to be safe.
+		if until.After(now) {
+			until = now
+		}
+		if last.Add(time.Second).After(until) {
+			return last, nil
+		}
+
+		events, err := c.FirewallEvents(zone, last.Add(time.Second), until)
+		if err != nil {
+			return last, err
+		}
+
+		if len(events) == 0 {
+			if until.Equal(now) {
+				return last, nil
+			}
+			// nothing happened in this window, move on to the next one.
+			last = until
+			continue
+		}
+
+		for _, evt := range events {
+			if err = emit(evt); err != nil {
+				return last, err
+			}
+			last = evt.Date
+		}
+	}
+}
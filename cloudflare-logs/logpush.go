@@ -0,0 +1,236 @@
+package cloudflarelogs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"github.com/blockpane/logsuck/internal/ndjson"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logpush datasets that can be normalized
+const (
+	DatasetHttpRequests   = "http_requests"
+	DatasetFirewallEvents = "firewall_events"
+	DatasetDnsLogs        = "dns_logs"
+)
+
+// LogpushEvent is a Logpush record normalized to the same field names the GraphQL poller emits for Event, with
+// a few extras for the datasets that don't map onto a firewall event.
+type LogpushEvent struct {
+	Event
+	Dataset      string `json:"dataset"`
+	Status       int    `json:"edgeResponseStatus,omitempty"`
+	QueryName    string `json:"queryName,omitempty"`
+	QueryType    string `json:"queryType,omitempty"`
+	ResponseCode string `json:"responseCode,omitempty"`
+	Colo         string `json:"coloCode,omitempty"`
+}
+
+// logpushRecord holds the union of the fields we use from each Logpush dataset.
+type logpushRecord struct {
+	// firewall_events
+	Action                string          `json:"Action"`
+	ClientASN             json.Number     `json:"ClientASN"`
+	ClientASNDescription  string          `json:"ClientASNDescription"`
+	ClientCountry         string          `json:"ClientCountry"`
+	ClientIP              string          `json:"ClientIP"`
+	ClientRequestHost     string          `json:"ClientRequestHost"`
+	ClientRequestMethod   string          `json:"ClientRequestMethod"`
+	ClientRequestPath     string          `json:"ClientRequestPath"`
+	ClientRequestProtocol string          `json:"ClientRequestProtocol"`
+	ClientRequestQuery    string          `json:"ClientRequestQuery"`
+	ClientRequestURI      string          `json:"ClientRequestURI"`
+	ClientRequestUA       string          `json:"ClientRequestUserAgent"`
+	Datetime              json.RawMessage `json:"Datetime"`
+	RayID                 string          `json:"RayID"`
+	RuleID                string          `json:"RuleID"`
+	Source                string          `json:"Source"`
+
+	// http_requests
+	EdgeStartTimestamp json.RawMessage `json:"EdgeStartTimestamp"`
+	EdgeResponseStatus int             `json:"EdgeResponseStatus"`
+	WAFAction          string          `json:"WAFAction"`
+	WAFRuleID          string          `json:"WAFRuleID"`
+	SecurityAction     string          `json:"SecurityAction"`
+	SecurityRuleID     string          `json:"SecurityRuleID"`
+
+	// dns_logs
+	Timestamp    json.RawMessage `json:"Timestamp"`
+	ColoCode     string          `json:"ColoCode"`
+	QueryName    string          `json:"QueryName"`
+	QueryType    json.Number     `json:"QueryType"`
+	ResponseCode json.Number     `json:"ResponseCode"`
+	SourceIP     string          `json:"SourceIP"`
+}
+
+// dataset guesses which Logpush dataset a record belongs to by the fields that are set.
+func (r logpushRecord) dataset() string {
+	switch {
+	case r.QueryName != "" || len(r.Timestamp) > 0:
+		return DatasetDnsLogs
+	case len(r.EdgeStartTimestamp) > 0:
+		return DatasetHttpRequests
+	default:
+		return DatasetFirewallEvents
+	}
+}
+
+// normalize converts the Logpush record into a LogpushEvent
+func (r logpushRecord) normalize(dataset string) (LogpushEvent, error) {
+	if dataset == "" {
+		dataset = r.dataset()
+	}
+	e := LogpushEvent{Dataset: dataset}
+	e.AsnDesc = r.ClientASNDescription
+	e.Asn = r.ClientASN.String()
+	e.Country = r.ClientCountry
+	e.Ip = ipaddr.Parse(r.ClientIP)
+	e.Host = r.ClientRequestHost
+	e.Method = r.ClientRequestMethod
+	e.Proto = r.ClientRequestProtocol
+	e.Path = r.ClientRequestPath
+	e.Query = r.ClientRequestQuery
+	e.Ray = r.RayID
+	e.UserAgent = r.ClientRequestUA
+
+	var err error
+	switch dataset {
+	case DatasetFirewallEvents:
+		e.Action = r.Action
+		e.Rule = r.RuleID
+		e.Source = r.Source
+		e.Date, err = parseLogpushTime(r.Datetime)
+	case DatasetHttpRequests:
+		e.Action = r.WAFAction
+		e.Rule = r.WAFRuleID
+		if r.SecurityAction != "" {
+			e.Action = r.SecurityAction
+			e.Rule = r.SecurityRuleID
+		}
+		if e.Path == "" && r.ClientRequestURI != "" {
+			e.Path = r.ClientRequestURI
+			if i := strings.Index(e.Path, "?"); i >= 0 {
+				e.Path, e.Query = e.Path[:i], e.Path[i:]
+			}
+		}
+		e.Status = r.EdgeResponseStatus
+		e.Date, err = parseLogpushTime(r.EdgeStartTimestamp)
+	case DatasetDnsLogs:
+		e.Ip = ipaddr.Parse(r.SourceIP)
+		e.QueryName = r.QueryName
+		e.QueryType = r.QueryType.String()
+		e.ResponseCode = r.ResponseCode.String()
+		e.Colo = r.ColoCode
+		e.Date, err = parseLogpushTime(r.Timestamp)
+	default:
+		return e, fmt.Errorf("unsupported logpush dataset %q", dataset)
+	}
+	return e, err
+}
+
+// parseLogpushTime handles each of the Logpush timestamp formats: rfc3339 strings, or unix seconds, milliseconds,
+// microseconds or nanoseconds. Integers are told apart by size, which works for any date from 1973 to 5138.
+func parseLogpushTime(raw json.RawMessage) (time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}, nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case n > 1e17:
+		return time.Unix(0, n).UTC(), nil
+	case n > 1e14:
+		return time.Unix(0, n*int64(time.Microsecond)).UTC(), nil
+	case n > 1e11:
+		return time.Unix(0, n*int64(time.Millisecond)).UTC(), nil
+	}
+	return time.Unix(n, 0).UTC(), nil
+}
+
+var logpushDatasets = []string{DatasetHttpRequests, DatasetFirewallEvents, DatasetDnsLogs}
+
+// SupportedDataset is true if Logpush records from the dataset can be normalized.
+func SupportedDataset(dataset string) bool {
+	for _, ds := range logpushDatasets {
+		if ds == dataset {
+			return true
+		}
+	}
+	return false
+}
+
+// DatasetFromKey finds the dataset name in a Logpush object key or path, returns an empty string if not found.
+func DatasetFromKey(key string) string {
+	for _, ds := range logpushDatasets {
+		if strings.Contains(key, ds) {
+			return ds
+		}
+	}
+	return ""
+}
+
+// DecodeLogpush reads newline delimited JSON from r, which may be gzipped, and calls emit for each record. Records are
+// decoded one at a time so arbitrarily large files never need to fit in memory. If dataset is empty it is guessed
+// per record.
+func DecodeLogpush(r io.Reader, dataset string, emit func(LogpushEvent) error) (count int, err error) {
+	_, err = DecodeLogpushRaw(r, func(raw json.RawMessage) error {
+		emitted, err := emitRecord(raw, dataset, emit)
+		if emitted {
+			count += 1
+		}
+		return err
+	})
+	return
+}
+
+// emitRecord decodes and normalizes one record and passes it to emit. Records that can't be normalized are logged and
+// skipped, emitted is false for those.
+func emitRecord(raw json.RawMessage, dataset string, emit func(LogpushEvent) error) (emitted bool, err error) {
+	rec := logpushRecord{}
+	if err = json.Unmarshal(raw, &rec); err != nil {
+		return false, err
+	}
+	evt, err := rec.normalize(dataset)
+	if err != nil {
+		log.Println("skipping logpush record:", err)
+		return false, nil
+	}
+	if err = emit(evt); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DecodeLogpushRaw streams each record from a (possibly gzipped) newline delimited JSON file without decoding it.
+func DecodeLogpushRaw(r io.Reader, emit func(json.RawMessage) error) (count int, err error) {
+	return ndjson.Decode(r, 0, emit)
+}
+
+// HandleS3Event processes S3 ObjectCreated notifications on a Logpush bucket. If dataset is empty it is taken from
+// each object's key.
+func HandleS3Event(ctx context.Context, svc s3iface.S3API, event events.S3Event, dataset string, emit func(LogpushEvent) error) error {
+	return ndjson.HandleS3Event(ctx, svc, event, "records", func(key string, body io.Reader) (int, error) {
+		ds := dataset
+		if ds == "" {
+			ds = DatasetFromKey(key)
+		}
+		return DecodeLogpush(body, ds, emit)
+	})
+}
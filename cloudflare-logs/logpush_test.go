@@ -0,0 +1,93 @@
+package cloudflarelogs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rawLogpush = map[string]string{
+	DatasetFirewallEvents: `{"Action":"block","ClientASN":4134,"ClientASNDescription":"CHINANET-BACKBONE","ClientCountry":"cn","ClientIP":"22.22.222.22","ClientRequestHost":"www.example.com","ClientRequestMethod":"GET","ClientRequestPath":"/wp-login.php","ClientRequestProtocol":"HTTP/1.1","ClientRequestQuery":"","ClientRequestUserAgent":"curl/7.68.0","Datetime":"2021-01-19T01:02:03Z","RayID":"613a1b2c3d4e5f60","RuleID":"100173","Source":"waf"}`,
+	DatasetHttpRequests:   `{"ClientASN":7922,"ClientCountry":"us","ClientIP":"2001:db8::1","ClientRequestHost":"www.example.com","ClientRequestMethod":"POST","ClientRequestProtocol":"HTTP/2","ClientRequestURI":"/login?next=/","ClientRequestUserAgent":"Mozilla/5.0","EdgeResponseStatus":403,"EdgeStartTimestamp":1611018123000000000,"RayID":"613a1b2c3d4e5f61","WAFAction":"drop","WAFRuleID":"981176"}`,
+	DatasetDnsLogs:        `{"ColoCode":"DEN","EDNSSubnet":"","QueryName":"example.com","QueryType":1,"ResponseCached":false,"ResponseCode":0,"SourceIP":"99.99.9.99","Timestamp":1611018123}`,
+}
+
+func TestDecodeLogpush(t *testing.T) {
+	for dataset, raw := range rawLogpush {
+		buf := &bytes.Buffer{}
+		gz := gzip.NewWriter(buf)
+		gz.Write([]byte(raw + "\n" + raw + "\n"))
+		gz.Close()
+
+		events := make([]LogpushEvent, 0)
+		count, err := DecodeLogpush(buf, "", func(e LogpushEvent) error {
+			events = append(events, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", dataset, err)
+		}
+		if count != 2 || len(events) != 2 {
+			t.Fatalf("%s: expected 2 events, got %d", dataset, count)
+		}
+		e := events[0]
+		if e.Dataset != dataset {
+			t.Errorf("expected dataset %s, got %s", dataset, e.Dataset)
+		}
+		if e.Ip == nil || e.Date.IsZero() {
+			t.Errorf("%s: ip or date not populated: %+v", dataset, e)
+		}
+		switch dataset {
+		case DatasetFirewallEvents:
+			if e.Asn != "4134" || e.Action != "block" || e.Rule != "100173" || e.Path != "/wp-login.php" {
+				t.Errorf("unexpected firewall event %+v", e)
+			}
+		case DatasetHttpRequests:
+			if e.Path != "/login" || e.Query != "?next=/" || e.Action != "drop" || e.Status != 403 {
+				t.Errorf("unexpected http event %+v", e)
+			}
+		case DatasetDnsLogs:
+			if e.QueryName != "example.com" || e.QueryType != "1" || e.Colo != "DEN" {
+				t.Errorf("unexpected dns event %+v", e)
+			}
+		}
+	}
+}
+
+func TestDecodeLogpushPlain(t *testing.T) {
+	count, err := DecodeLogpush(strings.NewReader(rawLogpush[DatasetFirewallEvents]), DatasetFirewallEvents, func(e LogpushEvent) error {
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 uncompressed record, got %d, %v", count, err)
+	}
+}
+
+func TestDatasetFromKey(t *testing.T) {
+	if ds := DatasetFromKey("logs/firewall_events/20210119/20210119T010000Z_20210119T010500Z_abc.log.gz"); ds != DatasetFirewallEvents {
+		t.Errorf("expected firewall_events, got %q", ds)
+	}
+	if ds := DatasetFromKey("20210119/20210119T010000Z_20210119T010500Z_abc.log.gz"); ds != "" {
+		t.Errorf("expected no dataset, got %q", ds)
+	}
+}
+
+func TestParseLogpushTime(t *testing.T) {
+	want := time.Date(2021, 1, 19, 1, 2, 3, 456789000, time.UTC)
+	for raw, expected := range map[string]time.Time{
+		`"2021-01-19T01:02:03.456789Z"`: want,
+		`1611018123`:                    want.Truncate(time.Second),
+		`1611018123456`:                 want.Truncate(time.Millisecond),
+		`1611018123456789`:              want,
+		`1611018123456789000`:           want,
+		`null`:                          {},
+	} {
+		got, err := parseLogpushTime(json.RawMessage(raw))
+		if err != nil || !got.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s, %v", raw, expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cloudflarelogs
+
+import (
+	"fmt"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"github.com/oschwald/geoip2-golang"
+	"log"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NormalizedEvent is an Event after the transforms that used to live in 20-filter-cloudflare.conf: fields are
+// renamed, clientAsn is an integer, datetime is copied to @timestamp and the source IP is optionally geolocated.
+type NormalizedEvent struct {
+	Type          string    `json:"type"`
+	Timestamp     time.Time `json:"@timestamp"`
+	Date          time.Time `json:"datetime"`
+	RequestStatus string    `json:"request_status,omitempty"`
+	AsnDesc       string    `json:"clientASNDescription,omitempty"`
+	Asn           int64     `json:"clientAsn,omitempty"`
+	Country       string    `json:"clientCountryName,omitempty"`
+	SrcIp         net.IP    `json:"src_ip,omitempty"`
+	SrcIpVersion  int       `json:"src_ip_version,omitempty"`
+	HttpHost      string    `json:"http_host,omitempty"`
+	Method        string    `json:"method,omitempty"`
+	Protocol      string    `json:"protocol,omitempty"`
+	Uri           string    `json:"uri,omitempty"`
+	Query         string    `json:"query,omitempty"`
+	Ray           string    `json:"rayName,omitempty"`
+	SigNames      string    `json:"sig_names,omitempty"`
+	Violations    string    `json:"violations,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	GeoIp         *GeoIp    `json:"geoip,omitempty"`
+}
+
+// NormalizedLogpushEvent adds the Logpush only fields to a NormalizedEvent
+type NormalizedLogpushEvent struct {
+	NormalizedEvent
+	Dataset      string `json:"dataset"`
+	Status       int    `json:"status,omitempty"`
+	QueryName    string `json:"query_name,omitempty"`
+	QueryType    string `json:"query_type,omitempty"`
+	ResponseCode string `json:"response_code,omitempty"`
+	Colo         string `json:"colo,omitempty"`
+}
+
+// GeoIp uses the same field names as the logstash geoip filter so existing dashboards keep working.
+type GeoIp struct {
+	Ip            net.IP    `json:"ip"`
+	CountryCode2  string    `json:"country_code2,omitempty"`
+	CountryName   string    `json:"country_name,omitempty"`
+	ContinentCode string    `json:"continent_code,omitempty"`
+	RegionCode    string    `json:"region_code,omitempty"`
+	RegionName    string    `json:"region_name,omitempty"`
+	CityName      string    `json:"city_name,omitempty"`
+	PostalCode    string    `json:"postal_code,omitempty"`
+	Timezone      string    `json:"timezone,omitempty"`
+	Latitude      float64   `json:"latitude,omitempty"`
+	Longitude     float64   `json:"longitude,omitempty"`
+	Location      *Location `json:"location,omitempty"`
+}
+
+// Location is a geo_point friendly lat/lon pair
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Normalizer converts events to the normalized output format, a nil Normalizer leaves events untouched.
+type Normalizer struct {
+	geo *geoip2.Reader
+}
+
+// NewNormalizer returns nil unless mode is "normalized". If geoDb is set it should be the path to a MaxMind
+// GeoLite2/GeoIP2 City database.
+func NewNormalizer(mode string, geoDb string) (*Normalizer, error) {
+	switch mode {
+	case "", "raw":
+		return nil, nil
+	case "normalized":
+	default:
+		return nil, fmt.Errorf("unknown output mode %q, expected raw or normalized", mode)
+	}
+	n := &Normalizer{}
+	if geoDb != "" {
+		var err error
+		n.geo, err = geoip2.Open(geoDb)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+// Normalize applies the renames and type conversions to an Event
+func (n *Normalizer) Normalize(e Event) NormalizedEvent {
+	ne := NormalizedEvent{
+		Type:          "cloudflare",
+		Timestamp:     e.Date,
+		Date:          e.Date,
+		RequestStatus: e.Action,
+		AsnDesc:       e.AsnDesc,
+		Country:       e.Country,
+		SrcIp:         e.Ip,
+		SrcIpVersion:  ipaddr.Version(e.Ip),
+		HttpHost:      e.Host,
+		Method:        e.Method,
+		Protocol:      e.Proto,
+		Uri:           e.Path,
+		Query:         e.Query,
+		Ray:           e.Ray,
+		SigNames:      e.Rule,
+		Violations:    e.Source,
+		UserAgent:     e.UserAgent,
+	}
+	if e.Asn != "" {
+		asn, err := strconv.ParseInt(e.Asn, 10, 64)
+		if err != nil {
+			log.Printf("warning: could not convert clientAsn %q to an integer\n", e.Asn)
+		}
+		ne.Asn = asn
+	}
+	ne.GeoIp = n.lookup(e.Ip)
+	return ne
+}
+
+// lookup geolocates an IP, it returns nil if there is no database or no match.
+func (n *Normalizer) lookup(ip net.IP) *GeoIp {
+	if n == nil || n.geo == nil || ip == nil {
+		return nil
+	}
+	city, err := n.geo.City(ip)
+	if err != nil || city == nil {
+		return nil
+	}
+	g := &GeoIp{
+		Ip:            ip,
+		CountryCode2:  city.Country.IsoCode,
+		CountryName:   city.Country.Names["en"],
+		ContinentCode: city.Continent.Code,
+		CityName:      city.City.Names["en"],
+		PostalCode:    city.Postal.Code,
+		Timezone:      city.Location.TimeZone,
+		Latitude:      city.Location.Latitude,
+		Longitude:     city.Location.Longitude,
+	}
+	if len(city.Subdivisions) > 0 {
+		g.RegionCode = city.Subdivisions[0].IsoCode
+		g.RegionName = city.Subdivisions[0].Names["en"]
+	}
+	if g.Latitude != 0 || g.Longitude != 0 {
+		g.Location = &Location{Lat: g.Latitude, Lon: g.Longitude}
+	}
+	return g
+}
+
+// Output returns what should be marshalled for an Event, either the Event itself or its normalized form.
+func (n *Normalizer) Output(e Event) interface{} {
+	if n == nil {
+		return e
+	}
+	return n.Normalize(e)
+}
+
+// OutputLogpush is the same as Output, but for a LogpushEvent
+func (n *Normalizer) OutputLogpush(e LogpushEvent) interface{} {
+	if n == nil {
+		return e
+	}
+	return NormalizedLogpushEvent{
+		NormalizedEvent: n.Normalize(e.Event),
+		Dataset:         e.Dataset,
+		Status:          e.Status,
+		QueryName:       e.QueryName,
+		QueryType:       e.QueryType,
+		ResponseCode:    e.ResponseCode,
+		Colo:            e.Colo,
+	}
+}
@@ -0,0 +1,64 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewNormalizer(t *testing.T) {
+	n, err := NewNormalizer("", "")
+	if err != nil || n != nil {
+		t.Errorf("expected a nil normalizer for raw output, got %v, %v", n, err)
+	}
+	if _, err = NewNormalizer("bogus", ""); err == nil {
+		t.Error("expected an error for an unknown output mode")
+	}
+	if _, err = NewNormalizer("normalized", "/does/not/exist.mmdb"); err == nil {
+		t.Error("expected an error for a missing geoip database")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	e := Event{
+		Action:  "block",
+		Asn:     "4134",
+		Ip:      net.ParseIP("22.22.222.22"),
+		Host:    "www.example.com",
+		Path:    "/wp-login.php",
+		Rule:    "100173",
+		Source:  "waf",
+		Date:    time.Date(2021, 1, 19, 1, 2, 3, 0, time.UTC),
+		Country: "CN",
+	}
+	var n *Normalizer
+	if _, ok := n.Output(e).(Event); !ok {
+		t.Error("expected a nil normalizer to pass the event through")
+	}
+
+	n, _ = NewNormalizer("normalized", "")
+	j, _ := json.Marshal(n.Output(e))
+	out := make(map[string]interface{})
+	json.Unmarshal(j, &out)
+	expected := map[string]interface{}{
+		"request_status": "block",
+		"clientAsn":      float64(4134),
+		"src_ip":         "22.22.222.22",
+		"src_ip_version": float64(4),
+		"http_host":      "www.example.com",
+		"uri":            "/wp-login.php",
+		"sig_names":      "100173",
+		"violations":     "waf",
+		"@timestamp":     "2021-01-19T01:02:03Z",
+		"type":           "cloudflare",
+	}
+	for k, v := range expected {
+		if out[k] != v {
+			t.Errorf("expected %s to be %v, got %v", k, v, out[k])
+		}
+	}
+	if _, ok := out["geoip"]; ok {
+		t.Error("did not expect geoip without a database")
+	}
+}
@@ -0,0 +1,182 @@
+package cloudflarelogs
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/blockpane/logsuck/internal/ndjson"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// DefaultSecretHeader is the header checked for the shared secret if none is configured
+const DefaultSecretHeader = "X-Logpush-Secret"
+
+// Limits on a single push if the receiver doesn't set its own. Logpush uploads are a few MB before compression.
+const (
+	DefaultMaxBodyBytes    = 16 << 20
+	DefaultMaxDecodedBytes = 256 << 20
+)
+
+// emitError wraps an error from Emit, so it can be told apart from a bad batch
+type emitError struct {
+	err error
+}
+
+func (e *emitError) Error() string {
+	return e.err.Error()
+}
+
+// LogpushReceiver accepts batches pushed by a Cloudflare Logpush HTTP destination. The destination should be
+// configured with the shared secret as a header, for example:
+//
+//	https://logs.example.com/logpush?dataset=http_requests&header_X-Logpush-Secret=<secret>
+type LogpushReceiver struct {
+	Header string
+	Secret string
+	Emit   func(LogpushEvent) error
+	// MaxBodyBytes and MaxDecodedBytes limit the size of a push before and after decompression, zero uses the
+	// defaults.
+	MaxBodyBytes    int64
+	MaxDecodedBytes int64
+}
+
+// NewLogpushReceiver builds a receiver that checks for secret in header (or the default header if empty), and
+// passes each record to emit.
+func NewLogpushReceiver(header string, secret string, emit func(LogpushEvent) error) (*LogpushReceiver, error) {
+	if header == "" {
+		header = DefaultSecretHeader
+	}
+	if secret == "" {
+		return nil, errors.New("refusing to start logpush receiver with an empty secret")
+	}
+	return &LogpushReceiver{Header: header, Secret: secret, Emit: emit}, nil
+}
+
+// authorized does a constant time comparison of the shared secret
+func (lr *LogpushReceiver) authorized(value string) bool {
+	return lr.Secret != "" && subtle.ConstantTimeCompare([]byte(value), []byte(lr.Secret)) == 1
+}
+
+// receive handles a single push, returning the HTTP status to reply with. Logpush doesn't retry a 4xx, so those are
+// only for pushes that would never work, a failure to emit is a 5xx and the batch is sent again.
+func (lr *LogpushReceiver) receive(secret string, dataset string, body io.Reader) (int, string) {
+	if !lr.authorized(secret) {
+		return http.StatusUnauthorized, "unauthorized"
+	}
+	// every record in a push for another dataset would be skipped, a 4xx at least shows up as failing in Cloudflare
+	if !SupportedDataset(dataset) {
+		log.Printf("rejecting logpush batch for unsupported dataset %q\n", dataset)
+		return http.StatusBadRequest, fmt.Sprintf("unsupported dataset %q", dataset)
+	}
+	emit := func(e LogpushEvent) error {
+		if err := lr.Emit(e); err != nil {
+			return &emitError{err: err}
+		}
+		return nil
+	}
+
+	// When a destination is created (and periodically after) Logpush sends a small file with a single "content"
+	// field to prove the endpoint works, for an ownership challenge it holds the token. It's not a log record, so
+	// the first record is held back until it's clear the batch has more than one.
+	var first json.RawMessage
+	records := 0
+	body = ndjson.LimitReader(body, maxOrDefault(lr.MaxBodyBytes, DefaultMaxBodyBytes))
+	_, err := ndjson.Decode(body, maxOrDefault(lr.MaxDecodedBytes, DefaultMaxDecodedBytes), func(raw json.RawMessage) error {
+		records += 1
+		switch records {
+		case 1:
+			first = raw
+			return nil
+		case 2:
+			if _, err := emitRecord(first, dataset, emit); err != nil {
+				return err
+			}
+		}
+		_, err := emitRecord(raw, dataset, emit)
+		return err
+	})
+	if err == nil && records == 1 {
+		if challenge, ok := ownershipChallenge(first); ok {
+			log.Printf("received logpush validation request, content: %s\n", challenge)
+			return http.StatusOK, "ok"
+		}
+		_, err = emitRecord(first, dataset, emit)
+	}
+
+	var ee *emitError
+	switch {
+	case err == nil:
+		return http.StatusOK, "ok"
+	case errors.Is(err, ndjson.ErrTooLarge):
+		log.Printf("rejecting logpush batch after %d records: %v\n", records, err)
+		return http.StatusRequestEntityTooLarge, "batch too large"
+	case errors.As(err, &ee):
+		log.Printf("could not emit logpush batch after %d records: %v\n", records, err)
+		return http.StatusInternalServerError, "could not emit batch"
+	}
+	log.Printf("error decoding logpush batch after %d records: %v\n", records, err)
+	return http.StatusBadRequest, "could not decode batch"
+}
+
+func maxOrDefault(n int64, def int64) int64 {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// ServeHTTP allows the receiver to run standalone.
+func (lr *LogpushReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	defer req.Body.Close()
+	// receive stops at the limit itself, this also stops the server reading any more of the request
+	body := http.MaxBytesReader(w, req.Body, maxOrDefault(lr.MaxBodyBytes, DefaultMaxBodyBytes)+1)
+	status, msg := lr.receive(req.Header.Get(lr.Header), datasetFromQuery(req.URL.Query().Get("dataset"), req.URL.Path), body)
+	w.WriteHeader(status)
+	w.Write([]byte(msg))
+}
+
+// HandleRequest allows the receiver to run behind API Gateway (HTTP API) or a Lambda function URL.
+func (lr *LogpushReceiver) HandleRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	var secret string
+	for k, v := range req.Headers {
+		if strings.EqualFold(k, lr.Header) {
+			secret = v
+			break
+		}
+	}
+	var body io.Reader = strings.NewReader(req.Body)
+	if req.IsBase64Encoded {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	status, msg := lr.receive(secret, datasetFromQuery(req.QueryStringParameters["dataset"], req.RawPath), body)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: msg}, nil
+}
+
+// datasetFromQuery prefers an explicit dataset parameter, and falls back to looking for it in the path
+func datasetFromQuery(dataset string, path string) string {
+	if dataset != "" {
+		return dataset
+	}
+	return DatasetFromKey(path)
+}
+
+// ownershipChallenge detects the test/ownership file Logpush sends, which is a single record with only "content".
+func ownershipChallenge(raw json.RawMessage) (string, bool) {
+	challenge := make(map[string]json.RawMessage)
+	if json.Unmarshal(raw, &challenge) != nil || len(challenge) != 1 {
+		return "", false
+	}
+	content, ok := challenge["content"]
+	return string(content), ok
+}
@@ -0,0 +1,116 @@
+package cloudflarelogs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(s string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(s))
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestLogpushReceiver(t *testing.T) {
+	received := make([]LogpushEvent, 0)
+	lr := &LogpushReceiver{Header: DefaultSecretHeader, Secret: "s3cr3t", Emit: func(e LogpushEvent) error {
+		received = append(received, e)
+		return nil
+	}}
+	srv := httptest.NewServer(lr)
+	defer srv.Close()
+
+	postTo := func(url string, secret string, body []byte) int {
+		req, _ := http.NewRequest("POST", url, bytes.NewReader(body))
+		req.Header.Set(DefaultSecretHeader, secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	post := func(secret string, body []byte) int {
+		return postTo(srv.URL+"/logpush?dataset=firewall_events", secret, body)
+	}
+
+	if status := post("wrong", gzipBytes(rawLogpush[DatasetFirewallEvents])); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad secret, got %d", status)
+	}
+	if status := post("s3cr3t", gzipBytes(`{"content":"tests"}`)); status != http.StatusOK || len(received) != 0 {
+		t.Errorf("expected validation request to be accepted and not emitted, got %d, %d events", status, len(received))
+	}
+	batch := strings.Repeat(rawLogpush[DatasetFirewallEvents]+"\n", 3)
+	if status := post("s3cr3t", gzipBytes(batch)); status != http.StatusOK || len(received) != 3 {
+		t.Errorf("expected 3 events, got %d, %d events", status, len(received))
+	}
+	if status := post("s3cr3t", []byte("{not json")); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad batch, got %d", status)
+	}
+	for _, url := range []string{srv.URL + "/logpush?dataset=audit_logs", srv.URL + "/logpush"} {
+		if status := postTo(url, "s3cr3t", gzipBytes(batch)); status != http.StatusBadRequest || len(received) != 3 {
+			t.Errorf("%s: expected 400 and nothing emitted, got %d, %d events", url, status, len(received))
+		}
+	}
+}
+
+func TestLogpushReceiverLambda(t *testing.T) {
+	count := 0
+	lr := &LogpushReceiver{Header: DefaultSecretHeader, Secret: "s3cr3t", Emit: func(e LogpushEvent) error {
+		count += 1
+		return nil
+	}}
+	resp, _ := lr.HandleRequest(context.Background(), events.APIGatewayV2HTTPRequest{
+		RawPath:         "/logpush/dns_logs",
+		Headers:         map[string]string{"x-logpush-secret": "s3cr3t"},
+		Body:            base64.StdEncoding.EncodeToString(gzipBytes(rawLogpush[DatasetDnsLogs])),
+		IsBase64Encoded: true,
+	})
+	if resp.StatusCode != http.StatusOK || count != 1 {
+		t.Errorf("expected one event from lambda request, got %d, %d events", resp.StatusCode, count)
+	}
+}
+
+func TestLogpushReceiverLimits(t *testing.T) {
+	var emitErr error
+	lr := &LogpushReceiver{Header: DefaultSecretHeader, Secret: "s3cr3t", MaxBodyBytes: 1024, MaxDecodedBytes: 4096,
+		Emit: func(e LogpushEvent) error { return emitErr }}
+	srv := httptest.NewServer(lr)
+	defer srv.Close()
+
+	post := func(body []byte) int {
+		req, _ := http.NewRequest("POST", srv.URL+"/logpush?dataset=firewall_events", bytes.NewReader(body))
+		req.Header.Set(DefaultSecretHeader, "s3cr3t")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post(gzipBytes(rawLogpush[DatasetFirewallEvents])); status != http.StatusOK {
+		t.Errorf("expected a small batch to be accepted, got %d", status)
+	}
+	if status := post(bytes.Repeat([]byte(" "), 2048)); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a body over the limit, got %d", status)
+	}
+	// compresses to well under MaxBodyBytes
+	if status := post(gzipBytes(strings.Repeat(" ", 1<<16))); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a batch that decompresses past the limit, got %d", status)
+	}
+	emitErr = errors.New("stdout is gone")
+	if status := post(gzipBytes(rawLogpush[DatasetFirewallEvents])); status != http.StatusInternalServerError {
+		t.Errorf("expected a 5xx so logpush retries when emit fails, got %d", status)
+	}
+}
@@ -0,0 +1,120 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"log"
+	"time"
+)
+
+// ParamStore reads settings from, and keeps checkpoints in, SSM parameter store.
+type ParamStore struct {
+	SSM ssmiface.SSMAPI
+	Now func() time.Time
+}
+
+// NewParamStore returns a ParamStore for the region.
+func NewParamStore(region string) (*ParamStore, error) {
+	if region == "" {
+		return nil, errors.New("is this running in Lambda? AWS_REGION env var missing")
+	}
+	awsSession, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(region),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ParamStore{SSM: ssm.New(awsSession), Now: time.Now}, nil
+}
+
+// Get fetches a single value.
+func (p *ParamStore) Get(name string, decrypt bool) (string, error) {
+	out, err := p.SSM.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(decrypt),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.Parameter == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.Parameter.Value), nil
+}
+
+// GetTime reads a RFC3339 checkpoint, if it is empty the current time is used.
+func (p *ParamStore) GetTime(name string) (time.Time, error) {
+	t, err := p.Get(name, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t != "" {
+		return time.Parse(time.RFC3339, t)
+	}
+	log.Println("warning: could not get last time from SSM, defaulting to now")
+	return p.Now(), nil
+}
+
+// SaveTime persists a checkpoint.
+func (p *ParamStore) SaveTime(name string, t time.Time) error {
+	_, err := p.SSM.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Overwrite: aws.Bool(true),
+		Type:      aws.String("String"),
+		Value:     aws.String(t.UTC().Format(time.RFC3339)),
+	})
+	return err
+}
+
+// GetCheckpoint reads a Checkpoint, if it is empty the current time is used.
+func (p *ParamStore) GetCheckpoint(name string) (Checkpoint, error) {
+	cp := Checkpoint{}
+	v, err := p.Get(name, false)
+	if err != nil {
+		return cp, err
+	}
+	if v == "" {
+		log.Println("warning: could not get checkpoint from SSM, defaulting to now")
+		cp.Last = p.Now().UTC().Truncate(time.Second)
+		return cp, nil
+	}
+	err = json.Unmarshal([]byte(v), &cp)
+	return cp, err
+}
+
+// SaveCheckpoint persists a Checkpoint as JSON.
+func (p *ParamStore) SaveCheckpoint(name string, cp Checkpoint) error {
+	j, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	_, err = p.SSM.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Overwrite: aws.Bool(true),
+		Type:      aws.String("String"),
+		Value:     aws.String(string(j)),
+	})
+	return err
+}
+
+// Required fetches each of the named parameters (decrypted), and fails if any are empty.
+func (p *ParamStore) Required(names ...string) ([]string, error) {
+	values := make([]string, len(names))
+	for i, name := range names {
+		v, err := p.Get(name, true)
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			return nil, errors.New("one or more required parameters were empty")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,68 @@
+package cloudflarelogs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"testing"
+	"time"
+)
+
+// fakeSSM keeps parameters in a map
+type fakeSSM struct {
+	ssmiface.SSMAPI
+	params map[string]string
+}
+
+func (f *fakeSSM) GetParameter(in *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(f.params[aws.StringValue(in.Name)])}}, nil
+}
+
+func (f *fakeSSM) PutParameter(in *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	f.params[aws.StringValue(in.Name)] = aws.StringValue(in.Value)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func TestParamStore(t *testing.T) {
+	ps := &ParamStore{
+		SSM: &fakeSSM{params: map[string]string{"/cloudflare/email": "user@example.com", "/cloudflare/key": "key"}},
+		Now: func() time.Time { return testNow },
+	}
+	last, err := ps.GetTime("/cloudflare/last")
+	if err != nil || !last.Equal(testNow) {
+		t.Errorf("expected an empty checkpoint to default to now, got %s, %v", last, err)
+	}
+	if err = ps.SaveTime("/cloudflare/last", testNow.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	last, err = ps.GetTime("/cloudflare/last")
+	if err != nil || !last.Equal(testNow.Add(-time.Hour)) {
+		t.Errorf("expected saved checkpoint, got %s, %v", last, err)
+	}
+	if _, err = ps.Required("/cloudflare/email", "/cloudflare/key", "/cloudflare/zone"); err == nil {
+		t.Error("expected an error for an empty required parameter")
+	}
+}
+
+func TestParamStoreCheckpoint(t *testing.T) {
+	ps := &ParamStore{
+		SSM: &fakeSSM{params: map[string]string{"/cloudflare/audit_last": `{"last":"2021-01-19T11:00:01Z"}`}},
+		Now: func() time.Time { return testNow },
+	}
+	cp, err := ps.GetCheckpoint("/cloudflare/audit_last")
+	if err != nil || !cp.Last.Equal(time.Date(2021, 1, 19, 11, 0, 1, 0, time.UTC)) || len(cp.Seen) != 0 {
+		t.Errorf("expected the stored checkpoint, got %+v, %v", cp, err)
+	}
+	cp.add(cp.Last, "a")
+	cp.add(cp.Last.Add(500*time.Millisecond), "b")
+	if err = ps.SaveCheckpoint("/cloudflare/audit_last", cp); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ps.GetCheckpoint("/cloudflare/audit_last")
+	if err != nil || !saved.Last.Equal(cp.Last) || len(saved.Seen) != 2 {
+		t.Errorf("expected the saved checkpoint, got %+v, %v", saved, err)
+	}
+	if cp, err = ps.GetCheckpoint("/cloudflare/new"); err != nil || !cp.Last.Equal(testNow) {
+		t.Errorf("expected an empty checkpoint to default to now, got %+v, %v", cp, err)
+	}
+}
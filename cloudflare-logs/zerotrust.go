@@ -0,0 +1,311 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Gateway datasets
+const (
+	GatewayDns  = "gateway_dns"
+	GatewayHttp = "gateway_http"
+)
+
+const (
+	accessPath    = "/accounts/%s/access/logs/access_requests"
+	accessPerPage = 1000
+	gatewayLimit  = 1000
+
+	gatewayDnsQuery = `query GatewayDns($accountTag: string, $filter: GatewayResolverQueriesAdaptiveFilter_InputObject) {
+          viewer {
+          accounts(filter: { accountTag: $accountTag }) {
+            gatewayResolverQueriesAdaptive(
+              filter: $filter
+              limit: 1000
+              orderBy: [datetime_ASC]
+            ) {
+              datetime
+              email
+              queryName
+              resolverDecision
+              policyName
+              locationName
+              categoryNames
+              srcIp
+              srcIpCountry
+            }
+          }
+        }
+      }`
+
+	gatewayHttpQuery = `query GatewayHttp($accountTag: string, $filter: GatewayL7RequestsAdaptiveFilter_InputObject) {
+          viewer {
+          accounts(filter: { accountTag: $accountTag }) {
+            gatewayL7RequestsAdaptive(
+              filter: $filter
+              limit: 1000
+              orderBy: [datetime_ASC]
+            ) {
+              datetime
+              email
+              action
+              httpHost
+              url
+              policyName
+              categoryNames
+              srcIp
+              srcIpCountry
+            }
+          }
+        }
+      }`
+)
+
+// ZeroTrustEvent is the flattened output for both Access and Gateway logs.
+type ZeroTrustEvent struct {
+	Kind         string    `json:"kind"`
+	Date         time.Time `json:"datetime"`
+	UserEmail    string    `json:"user_email,omitempty"`
+	App          string    `json:"app,omitempty"`
+	AppUid       string    `json:"app_uid,omitempty"`
+	Decision     string    `json:"decision,omitempty"`
+	Country      string    `json:"country,omitempty"`
+	SrcIp        net.IP    `json:"src_ip,omitempty"`
+	SrcIpVersion int       `json:"src_ip_version,omitempty"`
+	Action       string    `json:"action,omitempty"`
+	Connection   string    `json:"connection,omitempty"`
+	Ray          string    `json:"ray_id,omitempty"`
+	Policy       string    `json:"policy,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	Categories   []string  `json:"categories,omitempty"`
+	Url          string    `json:"url,omitempty"`
+}
+
+// flexString accepts either a JSON string or number, some GraphQL enums are returned as integers.
+type flexString string
+
+func (f *flexString) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*f = flexString(s)
+		return nil
+	}
+	if string(b) != "null" {
+		*f = flexString(b)
+	}
+	return nil
+}
+
+// AccessLog is an authentication event from the Access access_requests endpoint.
+type AccessLog struct {
+	Action     string    `json:"action"`
+	Allowed    bool      `json:"allowed"`
+	AppDomain  string    `json:"app_domain"`
+	AppUid     string    `json:"app_uid"`
+	Connection string    `json:"connection"`
+	CreatedAt  time.Time `json:"created_at"`
+	IpAddress  string    `json:"ip_address"`
+	RayId      string    `json:"ray_id"`
+	UserEmail  string    `json:"user_email"`
+	Country    string    `json:"country"`
+}
+
+// Flatten converts an AccessLog to a ZeroTrustEvent
+func (a AccessLog) Flatten() ZeroTrustEvent {
+	decision := "denied"
+	if a.Allowed {
+		decision = "allowed"
+	}
+	e := ZeroTrustEvent{
+		Kind:       "access",
+		Date:       a.CreatedAt,
+		UserEmail:  a.UserEmail,
+		App:        a.AppDomain,
+		AppUid:     a.AppUid,
+		Decision:   decision,
+		Country:    a.Country,
+		SrcIp:      ipaddr.Parse(a.IpAddress),
+		Action:     a.Action,
+		Connection: a.Connection,
+		Ray:        a.RayId,
+	}
+	e.SrcIpVersion = ipaddr.Version(e.SrcIp)
+	return e
+}
+
+// id identifies the event in a Checkpoint
+func (a AccessLog) id() string {
+	return eventId(a.RayId, a.UserEmail, a.AppUid, a.Action, a.CreatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// GatewayLog holds the fields from both the Gateway DNS and HTTP datasets.
+type GatewayLog struct {
+	Date             time.Time  `json:"datetime"`
+	Email            string     `json:"email"`
+	QueryName        string     `json:"queryName"`
+	ResolverDecision flexString `json:"resolverDecision"`
+	Action           flexString `json:"action"`
+	HttpHost         string     `json:"httpHost"`
+	Url              string     `json:"url"`
+	PolicyName       string     `json:"policyName"`
+	LocationName     string     `json:"locationName"`
+	CategoryNames    []string   `json:"categoryNames"`
+	SrcIp            string     `json:"srcIp"`
+	SrcIpCountry     string     `json:"srcIpCountry"`
+}
+
+// Flatten converts a GatewayLog to a ZeroTrustEvent, kind is either gateway_dns or gateway_http
+func (g GatewayLog) Flatten(kind string) ZeroTrustEvent {
+	e := ZeroTrustEvent{
+		Kind:       kind,
+		Date:       g.Date,
+		UserEmail:  g.Email,
+		Country:    g.SrcIpCountry,
+		SrcIp:      ipaddr.Parse(g.SrcIp),
+		Policy:     g.PolicyName,
+		Location:   g.LocationName,
+		Categories: g.CategoryNames,
+		Url:        g.Url,
+	}
+	if kind == GatewayDns {
+		e.App = g.QueryName
+		e.Decision = string(g.ResolverDecision)
+	} else {
+		e.App = g.HttpHost
+		e.Decision = string(g.Action)
+	}
+	e.SrcIpVersion = ipaddr.Version(e.SrcIp)
+	return e
+}
+
+// id identifies the event in a Checkpoint, Gateway logs have no id of their own so it covers every field.
+func (g GatewayLog) id() string {
+	j, _ := json.Marshal(g)
+	return eventId(string(j))
+}
+
+// GatewayResponse is the GraphQL response for either of the Gateway queries.
+type GatewayResponse struct {
+	Viewer struct {
+		Accounts []struct {
+			Dns  []GatewayLog `json:"gatewayResolverQueriesAdaptive"`
+			Http []GatewayLog `json:"gatewayL7RequestsAdaptive"`
+		} `json:"accounts"`
+	} `json:"viewer"`
+}
+
+// NewAccessQuery builds the query string for a page of Access authentication logs.
+func NewAccessQuery(since time.Time, until time.Time, page int) url.Values {
+	v := url.Values{}
+	v.Set("since", since.UTC().Format(time.RFC3339))
+	v.Set("until", until.UTC().Format(time.RFC3339))
+	v.Set("direction", "asc")
+	v.Set("page", strconv.Itoa(page))
+	v.Set("per_page", strconv.Itoa(accessPerPage))
+	v.Set("limit", strconv.Itoa(accessPerPage))
+	return v
+}
+
+// CollectAccessLogs calls emit for each Access authentication event since the checkpoint that wasn't already
+// emitted, and returns the new checkpoint, which is still valid if an error is also returned.
+func (c *Client) CollectAccessLogs(account string, cp Checkpoint, emit func(ZeroTrustEvent) error) (Checkpoint, error) {
+	since := cp.Last
+	until := c.Now().UTC().Truncate(time.Second)
+	if since.After(until) {
+		return cp, nil
+	}
+	skip := cp.skip()
+	for page := 1; ; page++ {
+		logs := make([]AccessLog, 0)
+		response, err := c.getApi(fmt.Sprintf(accessPath, url.PathEscape(account)), NewAccessQuery(since, until, page), &logs)
+		if err != nil {
+			return cp, err
+		}
+		for _, a := range logs {
+			id := a.id()
+			if skip(a.CreatedAt, id) {
+				continue
+			}
+			if err = emit(a.Flatten()); err != nil {
+				return cp, err
+			}
+			cp.add(a.CreatedAt, id)
+		}
+		if !response.ResultInfo.More(len(logs), accessPerPage) {
+			return cp, nil
+		}
+	}
+}
+
+// NewGatewayQuery builds the GraphQL request for one of the Gateway datasets, both ends are inclusive.
+func NewGatewayQuery(query string, since time.Time, until time.Time, account string) GraphRequest {
+	return GraphRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"accountTag": account,
+			"filter": map[string]string{
+				"datetime_geq": since.UTC().Format(time.RFC3339),
+				"datetime_leq": until.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+// CollectGatewayLogs calls emit for each Gateway event of kind (GatewayDns or GatewayHttp) since the checkpoint that
+// wasn't already emitted, and returns the new checkpoint, which is still valid if an error is also returned. The API
+// only pages by time, so each query starts at the newest second emitted so far and skips what was already emitted in
+// it, until a query returns less than the limit.
+func (c *Client) CollectGatewayLogs(account string, kind string, cp Checkpoint, emit func(ZeroTrustEvent) error) (Checkpoint, error) {
+	query := gatewayDnsQuery
+	switch kind {
+	case GatewayDns:
+	case GatewayHttp:
+		query = gatewayHttpQuery
+	default:
+		return cp, fmt.Errorf("unknown gateway dataset %q", kind)
+	}
+	until := c.Now().UTC().Truncate(time.Second)
+	for !cp.Last.After(until) {
+		since := cp.Last
+		skip := cp.skip()
+		response := &GatewayResponse{}
+		if err := c.postGraphQL(NewGatewayQuery(query, since, until, account), response); err != nil {
+			return cp, err
+		}
+		if len(response.Viewer.Accounts) == 0 {
+			break
+		}
+		logs := response.Viewer.Accounts[0].Dns
+		if kind == GatewayHttp {
+			logs = response.Viewer.Accounts[0].Http
+		}
+		for _, g := range logs {
+			id := g.id()
+			if skip(g.Date, id) {
+				continue
+			}
+			if err := emit(g.Flatten(kind)); err != nil {
+				return cp, err
+			}
+			cp.add(g.Date, id)
+		}
+		if len(logs) < gatewayLimit {
+			break
+		}
+		// a whole page in one second can't be paged past with a time filter, the rest of that second is lost
+		if !logs[len(logs)-1].Date.UTC().Truncate(time.Second).After(since) {
+			log.Printf("more than %d %s events at %s, skipping the rest of that second\n", gatewayLimit, kind, since.Format(time.RFC3339))
+			cp = Checkpoint{Last: since.Add(time.Second)}
+		}
+	}
+	return cp, nil
+}
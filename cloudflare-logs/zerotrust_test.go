@@ -0,0 +1,165 @@
+package cloudflarelogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFlatten(t *testing.T) {
+	raw := `{"action":"login","allowed":false,"app_domain":"test.example.com/admin","app_uid":"df7e2w5f-02b7-4d9d-af26-8d1988fca630","connection":"saml","created_at":"2014-01-01T05:20:00.12345Z","ip_address":"198.41.129.166","ray_id":"187d944c61940c77","user_email":"user@example.com","country":"us"}`
+	a := AccessLog{}
+	if err := json.Unmarshal([]byte(raw), &a); err != nil {
+		t.Fatal(err)
+	}
+	e := a.Flatten()
+	if e.Kind != "access" || e.UserEmail != "user@example.com" || e.App != "test.example.com/admin" || e.Decision != "denied" || e.Country != "us" || e.SrcIp.String() != "198.41.129.166" {
+		t.Errorf("unexpected access event: %+v", e)
+	}
+}
+
+func TestGatewayLogFlatten(t *testing.T) {
+	dns := GatewayLog{}
+	if err := json.Unmarshal([]byte(`{"datetime":"2021-01-19T01:02:03Z","email":"user@example.com","queryName":"malware.example","resolverDecision":3,"srcIp":"2001:db8::1","srcIpCountry":"US"}`), &dns); err != nil {
+		t.Fatal(err)
+	}
+	e := dns.Flatten("gateway_dns")
+	if e.App != "malware.example" || e.Decision != "3" || e.SrcIp.String() != "2001:db8::1" || e.SrcIpVersion != 6 || e.UserEmail != "user@example.com" {
+		t.Errorf("unexpected gateway dns event: %+v", e)
+	}
+
+	http := GatewayLog{}
+	if err := json.Unmarshal([]byte(`{"datetime":"2021-01-19T01:02:03Z","email":"user@example.com","action":"block","httpHost":"www.example.com","srcIp":"99.99.9.99","srcIpCountry":"US"}`), &http); err != nil {
+		t.Fatal(err)
+	}
+	e = http.Flatten("gateway_http")
+	if e.App != "www.example.com" || e.Decision != "block" || e.Country != "US" {
+		t.Errorf("unexpected gateway http event: %+v", e)
+	}
+}
+
+// graphqlGateway serves Gateway DNS logs from a fixed list the way the API does, up to the limit from datetime_geq.
+func graphqlGateway(t *testing.T, logs []GatewayLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Variables struct {
+				Filter map[string]string `json:"filter"`
+			} `json:"variables"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		geq, err := time.Parse(time.RFC3339, req.Variables.Filter["datetime_geq"])
+		if err != nil {
+			t.Fatalf("expected a datetime_geq filter: %v", err)
+		}
+		leq, _ := time.Parse(time.RFC3339, req.Variables.Filter["datetime_leq"])
+		found := make([]GatewayLog, 0)
+		for _, g := range logs {
+			if !g.Date.Before(geq) && !g.Date.After(leq) && len(found) < gatewayLimit {
+				found = append(found, g)
+			}
+		}
+		resp := struct {
+			Data GatewayResponse `json:"data"`
+		}{}
+		resp.Data.Viewer.Accounts = append(resp.Data.Viewer.Accounts, struct {
+			Dns  []GatewayLog `json:"gatewayResolverQueriesAdaptive"`
+			Http []GatewayLog `json:"gatewayL7RequestsAdaptive"`
+		}{Dns: found})
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func gatewayLogs(start time.Time, n int, perSecond int) []GatewayLog {
+	logs := make([]GatewayLog, n)
+	for i := range logs {
+		logs[i] = GatewayLog{
+			Date:      start.Add(time.Duration(i/perSecond) * time.Second),
+			QueryName: fmt.Sprintf("host%d.example", i),
+		}
+	}
+	return logs
+}
+
+func TestCollectGatewayLogs(t *testing.T) {
+	start := testNow.Add(-time.Hour)
+	// pages end part way through a second
+	logs := gatewayLogs(start, 2500, 7)
+	c := newTestClient(t, graphqlGateway(t, logs))
+	emitted := make(map[string]int)
+	cp, err := c.CollectGatewayLogs("acct", GatewayDns, Checkpoint{Last: start}, func(e ZeroTrustEvent) error {
+		emitted[e.App] += 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != len(logs) {
+		t.Errorf("expected all %d events, got %d", len(logs), len(emitted))
+	}
+	for app, n := range emitted {
+		if n != 1 {
+			t.Errorf("%s emitted %d times", app, n)
+		}
+	}
+	if want := logs[len(logs)-1].Date; !cp.Last.Equal(want) || len(cp.Seen) != len(logs)%7 {
+		t.Errorf("unexpected checkpoint %s with %d seen, expected %s", cp.Last, len(cp.Seen), want)
+	}
+
+	// the next run only gets what's new, including late events for the last second
+	logs = append(logs, GatewayLog{Date: cp.Last, QueryName: "late.example"})
+	c = newTestClient(t, graphqlGateway(t, logs))
+	emitted = make(map[string]int)
+	if _, err = c.CollectGatewayLogs("acct", GatewayDns, cp, func(e ZeroTrustEvent) error {
+		emitted[e.App] += 1
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 1 || emitted["late.example"] != 1 {
+		t.Errorf("expected only the late event, got %v", emitted)
+	}
+}
+
+func TestCollectGatewayLogsFullSecond(t *testing.T) {
+	start := testNow.Add(-time.Hour)
+	logs := append(gatewayLogs(start, gatewayLimit+10, gatewayLimit+10), GatewayLog{Date: start.Add(time.Second), QueryName: "next.example"})
+	c := newTestClient(t, graphqlGateway(t, logs))
+	count := 0
+	cp, err := c.CollectGatewayLogs("acct", GatewayDns, Checkpoint{Last: start}, func(e ZeroTrustEvent) error {
+		count += 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != gatewayLimit+1 || !cp.Last.Equal(start.Add(time.Second)) {
+		t.Errorf("expected a page from the full second and then the next one, got %d events up to %s", count, cp.Last)
+	}
+}
+
+func TestCollectAccessLogsSameSecond(t *testing.T) {
+	var since string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		since = r.URL.Query().Get("since")
+		fmt.Fprint(w, `{"success":true,"errors":[],"result":[`+
+			`{"ray_id":"a","created_at":"2021-01-19T11:00:00Z"},{"ray_id":"b","created_at":"2021-01-19T11:00:00Z"}`+
+			`],"result_info":{"page":1,"total_pages":1}}`)
+	})
+	last := time.Date(2021, 1, 19, 11, 0, 0, 0, time.UTC)
+	a := AccessLog{RayId: "a", CreatedAt: last}
+	rays := make([]string, 0)
+	cp, err := c.CollectAccessLogs("acct", Checkpoint{Last: last, Seen: []string{a.id()}}, func(e ZeroTrustEvent) error {
+		rays = append(rays, e.Ray)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if since != last.Format(time.RFC3339) || len(rays) != 1 || rays[0] != "b" || len(cp.Seen) != 2 {
+		t.Errorf("expected only b from the checkpoint's second, got %v from %s, checkpoint %+v", rays, since, cp)
+	}
+}
@@ -10,8 +10,12 @@ func main() {
 }
 
 func HandleRequest() (msg string, err error) {
-	startTs := gsuitelogs.GetLastTS()
-	token, err := gsuitelogs.GetTokenSSM()
+	client, err := gsuitelogs.NewClient(gsuitelogs.NewAwsDetails(), gsuitelogs.NewS3Details())
+	if err != nil {
+		return "could not setup AWS clients", err
+	}
+	startTs := client.GetLastTS()
+	token, err := client.GetTokenSSM()
 	if err != nil {
 		return "could not fetch token from SSM", err
 	}
@@ -26,11 +30,11 @@ func HandleRequest() (msg string, err error) {
 	if len(report) == 0 {
 		return "no new logs", nil
 	}
-	err = gsuitelogs.SaveLog(report)
+	err = client.SaveLog(report)
 	if err != nil {
 		return "Could not save logs", err
 	}
-	err = gsuitelogs.SaveLastTS(latest)
+	err = client.SaveLastTS(latest)
 	if err != nil {
 		return "Could not save latest timestamp", err
 	}
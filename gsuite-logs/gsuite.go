@@ -75,14 +75,6 @@ func FlattenLog(a *admin.Activity) FlattenedLog {
 	return l
 }
 
-// pagesCallback handles collating events into the pages slice from admin.ActivitiesListCall.Pages
-func pagesCallback(report *admin.Activities) error {
-	for _, i := range report.Items {
-		pages = append(pages, i)
-	}
-	return nil
-}
-
 // GetLoginLogs fetches all the login data from the admin reports api, that occurred after the date specified.
 // The returned byte slice is marshalled json
 func GetLoginLogs(service *admin.Service, startTime int64) (results []byte, latestTs int64, err error) {
@@ -91,7 +83,11 @@ func GetLoginLogs(service *admin.Service, startTime int64) (results []byte, late
 	latest := start
 	log.Println("Searching for logs after", start.Format(time.RFC3339))
 	a := service.Activities.List("all", "login")
-	err = a.StartTime(start.Format(time.RFC3339Nano)).Pages(context.Background(), pagesCallback)
+	pages := make([]*admin.Activity, 0)
+	err = a.StartTime(start.Format(time.RFC3339Nano)).Pages(context.Background(), func(report *admin.Activities) error {
+		pages = append(pages, report.Items...)
+		return nil
+	})
 	if err != nil {
 		log.Printf("ERROR: when retrieving logs, %v\n", err)
 		return nil, latest.Unix(), err
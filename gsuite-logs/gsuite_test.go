@@ -6,7 +6,8 @@ import (
 )
 
 func TestGetLoginLogs(t *testing.T) {
-	creds, err := GetTokenSSM()
+	c := testClient(t)
+	creds, err := c.GetTokenSSM()
 	if err != nil {
 		t.Errorf("could not get oauth2 token: %v\n", err)
 	}
@@ -23,8 +24,8 @@ func TestGetLoginLogs(t *testing.T) {
 		t.Error("got a 0 timestamp from google report api for the latest record")
 	}
 	//fmt.Println(string(results))
-	s3Details.SavePrefix = `gsuite-logs/tests/`
-	err = SaveLog(results)
+	c.S3Details.SavePrefix = `gsuite-logs/tests/`
+	err = c.SaveLog(results)
 	if err != nil {
 		t.Error("could not write log")
 	}
@@ -1,29 +1,48 @@
 package gsuitelogs
 
 import (
+	"errors"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/ssm"
-	admin "google.golang.org/api/admin/reports/v1"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 )
 
-var (
-	awsDetails = NewAwsDetails()
-	s3Details  = NewS3Details()
-	awsSession = session.Must(
-		session.NewSession(
-			&aws.Config{
-				Region: aws.String(awsDetails.Region),
-			},
-		),
+// Client keeps the oauth2 token in SSM parameter store, and the logs and the latest timestamp in S3.
+type Client struct {
+	SSM       ssmiface.SSMAPI
+	S3        s3iface.S3API
+	Aws       AwsDetails
+	S3Details S3Details
+}
+
+// NewClient returns a Client with sessions for the regions in the details.
+func NewClient(awsDetails AwsDetails, s3Details S3Details) (*Client, error) {
+	if s3Details.Bucket == "" {
+		return nil, errors.New("S3_BUCKET env var missing")
+	}
+	awsSession, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(awsDetails.Region),
+		},
 	)
-	s3Session = session.Must(
-		session.NewSession(
-			&aws.Config{
-				Region: aws.String(s3Details.Region),
-			},
-		),
+	if err != nil {
+		return nil, err
+	}
+	s3Session, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(s3Details.Region),
+		},
 	)
-	paramStore = ssm.New(awsSession, aws.NewConfig().WithRegion(awsDetails.Region))
-	pages      = make([]*admin.Activity, 0)
-)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		SSM:       ssm.New(awsSession),
+		S3:        s3.New(s3Session),
+		Aws:       awsDetails,
+		S3Details: s3Details,
+	}, nil
+}
@@ -14,12 +14,12 @@ import (
 
 // GetLastTS pulls a file from S3 that has the latest UNIX timestamp for retrieved logs.
 // if it can't find the file, it will return 0
-func GetLastTS() int64 {
+func (c *Client) GetLastTS() int64 {
 	buff := aws.NewWriteAtBuffer([]byte{})
-	downloader := s3manager.NewDownloader(s3Session)
+	downloader := s3manager.NewDownloaderWithClient(c.S3)
 	_, err := downloader.Download(buff, &s3.GetObjectInput{
-		Bucket: aws.String(s3Details.Bucket),
-		Key:    aws.String(s3Details.Key),
+		Bucket: aws.String(c.S3Details.Bucket),
+		Key:    aws.String(c.S3Details.Key),
 	})
 	if err != nil {
 		log.Printf("WARN: failed to download state file, %v", err)
@@ -35,14 +35,14 @@ func GetLastTS() int64 {
 
 // SaveLastTS saves a text file with a unix timestamp representing the latest record we got
 // into a S3 object.
-func SaveLastTS(last int64) error {
+func (c *Client) SaveLastTS(last int64) error {
 	buff := bytes.NewBuffer([]byte(fmt.Sprintf("%d", last)))
-	uploader := s3manager.NewUploader(s3Session)
+	uploader := s3manager.NewUploaderWithClient(c.S3)
 	_, err := uploader.Upload(&s3manager.UploadInput{
 		Body:   buff,
-		Bucket: aws.String(s3Details.Bucket),
+		Bucket: aws.String(c.S3Details.Bucket),
 		//Key:                       aws.String(fmt.Sprintf("%s/%d.json", s3Details.SavePrefix, time.Now().UTC().Unix())),
-		Key:                  aws.String(s3Details.Key),
+		Key:                  aws.String(c.S3Details.Key),
 		ServerSideEncryption: aws.String("AES256"),
 	})
 	return err
@@ -50,13 +50,13 @@ func SaveLastTS(last int64) error {
 
 // SaveLog writes a logfile to S3, be sure to run this before SaveLastTS and skip writing the TS if this fails.
 // the input should be a byte buffer containing rows of JSON text.
-func SaveLog(result []byte) error {
+func (c *Client) SaveLog(result []byte) error {
 	buff := bytes.NewReader(result)
-	uploader := s3manager.NewUploader(s3Session)
+	uploader := s3manager.NewUploaderWithClient(c.S3)
 	_, err := uploader.Upload(&s3manager.UploadInput{
 		Body:                 buff,
-		Bucket:               aws.String(s3Details.Bucket),
-		Key:                  aws.String(fmt.Sprintf("%s/%d.json", s3Details.SavePrefix, time.Now().UTC().Unix())),
+		Bucket:               aws.String(c.S3Details.Bucket),
+		Key:                  aws.String(fmt.Sprintf("%s/%d.json", c.S3Details.SavePrefix, time.Now().UTC().Unix())),
 		ServerSideEncryption: aws.String("AES256"),
 	})
 	return err
@@ -70,7 +70,8 @@ type S3Details struct {
 	SavePrefix string
 }
 
-// NewS3Details reads environment variables, and if missing returns sensible defaults.
+// NewS3Details reads environment variables, and if missing returns sensible defaults. There is no default bucket,
+// NewClient returns an error if it isn't set.
 func NewS3Details() S3Details {
 	details := S3Details{
 		Region:     os.Getenv(`S3_REGION`),
@@ -81,9 +82,6 @@ func NewS3Details() S3Details {
 	if details.Region == "" {
 		details.Region = `us-east-1`
 	}
-	if details.Bucket == "" {
-		log.Fatal("S3_BUCKET env var missing")
-	}
 	if details.Key == "" {
 		details.Key = "gsuite-logs/latest.txt"
 	}
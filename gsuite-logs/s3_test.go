@@ -6,24 +6,27 @@ import (
 )
 
 func TestSaveLastTS(t *testing.T) {
-	s3Details.Key = `gsuite-logs/tests/latest.txt`
-	err := SaveLastTS(time.Now().Unix())
+	c := testClient(t)
+	c.S3Details.Key = `gsuite-logs/tests/latest.txt`
+	err := c.SaveLastTS(time.Now().Unix())
 	if err != nil {
 		t.Errorf("could not save state file: %v\n", err)
 	}
 }
 
 func TestGetLastTS(t *testing.T) {
-	s3Details.Key = `gsuite-logs/tests/latest.txt`
-	last := GetLastTS()
+	c := testClient(t)
+	c.S3Details.Key = `gsuite-logs/tests/latest.txt`
+	last := c.GetLastTS()
 	if last == 0 {
 		t.Error("could not read last timestamp")
 	}
 }
 
 func TestSaveLog(t *testing.T) {
-	s3Details.SavePrefix = `gsuite-logs/tests/`
-	err := SaveLog([]byte(`{"test":"file"}`))
+	c := testClient(t)
+	c.S3Details.SavePrefix = `gsuite-logs/tests/`
+	err := c.SaveLog([]byte(`{"test":"file"}`))
 	if err != nil {
 		t.Error("could not write log")
 	}
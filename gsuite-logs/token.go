@@ -18,27 +18,29 @@ import (
 type OauthConfigAndToken struct {
 	Config *oauth2.Config
 	Token  *oauth2.Token
+
+	client *Client // where Save persists the token
 }
 
 // GetTokenSSM retrieves a saved oauth2.Token from AWS SSM/Parameter store.
-func GetTokenSSM() (OauthConfigAndToken, error) {
-	tokenParam, err := paramStore.GetParameter(
+func (c *Client) GetTokenSSM() (OauthConfigAndToken, error) {
+	tokenParam, err := c.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name:           aws.String(awsDetails.TokenParameter),
+			Name:           aws.String(c.Aws.TokenParameter),
 			WithDecryption: aws.Bool(true),
 		},
 	)
 	if err != nil {
 		return OauthConfigAndToken{}, err
 	}
-	config := OauthConfigAndToken{}
+	config := OauthConfigAndToken{client: c}
 	err = json.Unmarshal([]byte(*tokenParam.Parameter.Value), &config.Token)
 	if err != nil {
 		return OauthConfigAndToken{}, err
 	}
-	configParam, err := paramStore.GetParameter(
+	configParam, err := c.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name:           aws.String(awsDetails.ConfigParameter),
+			Name:           aws.String(c.Aws.ConfigParameter),
 			WithDecryption: aws.Bool(true),
 		},
 	)
@@ -91,11 +93,13 @@ func (o OauthConfigAndToken) Save() error {
 		return err
 	} else if len(j) == 0 {
 		return errors.New("refusing to save empty token")
+	} else if o.client == nil {
+		return errors.New("token was not loaded with a Client, can't save it")
 	}
-	_, err = paramStore.PutParameter(
+	_, err = o.client.SSM.PutParameter(
 		&ssm.PutParameterInput{
 			Description: aws.String(`gsuite logs oauth2 token`),
-			Name:        aws.String(awsDetails.TokenParameter),
+			Name:        aws.String(o.client.Aws.TokenParameter),
 			Overwrite:   aws.Bool(true),
 			Type:        aws.String(`SecureString`),
 			Value:       aws.String(string(j)),
@@ -111,7 +115,8 @@ type AwsDetails struct {
 	ConfigParameter string `json:"config_parameter"`
 }
 
-// NewAwsDetails reads environment variables, and if missing returns sensible defaults.
+// NewAwsDetails reads environment variables, and if missing returns sensible defaults. It's only called by the Lambda,
+// importing the package doesn't read anything from the environment.
 func NewAwsDetails() AwsDetails {
 	details := AwsDetails{
 		Region:          os.Getenv(`REGION`),
@@ -5,8 +5,17 @@ import (
 	"testing"
 )
 
+// testClient builds a Client from the environment, these tests run against real AWS and Google accounts.
+func testClient(t *testing.T) *Client {
+	c, err := NewClient(NewAwsDetails(), NewS3Details())
+	if err != nil {
+		t.Fatalf("could not setup AWS clients: %v\n", err)
+	}
+	return c
+}
+
 func TestGetTokenSSM(t *testing.T) {
-	token, err := GetTokenSSM()
+	token, err := testClient(t).GetTokenSSM()
 	if err != nil {
 		t.Errorf("%v", err)
 	}
@@ -0,0 +1,145 @@
+package guarddutylogs
+
+import "github.com/blockpane/logsuck/internal/strutil"
+
+// SeverityLabel gives the console's label for a GuardDuty severity: Low is 1.0-3.9, Medium 4.0-6.9, High 7.0-8.9
+// and Critical 9.0-10.0. Anything below 1 has no label.
+func SeverityLabel(severity float64) string {
+	switch {
+	case severity >= 9:
+		return "Critical"
+	case severity >= 7:
+		return "High"
+	case severity >= 4:
+		return "Medium"
+	case severity >= 1:
+		return "Low"
+	}
+	return ""
+}
+
+// FindingType is a finding type split into its parts, which are
+// ThreatPurpose:ResourceTypeAffected/ThreatFamilyName.DetectionMechanism!Artifact, for example
+// Backdoor:EC2/C&CActivity.B!DNS. Only the purpose, resource and family are always present.
+type FindingType struct {
+	ThreatPurpose      string
+	ResourceType       string
+	ThreatFamily       string
+	DetectionMechanism string
+	Artifact           string
+}
+
+// ParseType splits a finding type, a string that doesn't follow the format leaves the remaining parts empty.
+func ParseType(s string) FindingType {
+	t := FindingType{}
+	purpose, rest, ok := strutil.Cut(s, ":")
+	if !ok {
+		return t
+	}
+	t.ThreatPurpose = purpose
+	t.ResourceType, rest, ok = strutil.Cut(rest, "/")
+	if !ok {
+		return t
+	}
+	rest, t.Artifact, _ = strutil.Cut(rest, "!")
+	t.ThreatFamily, t.DetectionMechanism, _ = strutil.Cut(rest, ".")
+	return t
+}
+
+// key is the type without the detection mechanism and artifact, which is what the ATT&CK table is keyed on.
+func (t FindingType) key() string {
+	return t.ThreatPurpose + ":" + t.ResourceType + "/" + t.ThreatFamily
+}
+
+// Attack holds the MITRE ATT&CK tactic and technique IDs for a finding type
+type Attack struct {
+	Tactics    []string
+	Techniques []string
+}
+
+// attackByType maps the finding types we see most often to ATT&CK. The key leaves off the detection mechanism and
+// artifact, so Backdoor:EC2/C&CActivity covers both C&CActivity.B and C&CActivity.B!DNS. Add new types here, anything
+// missing falls back to attackByPurpose.
+var attackByType = map[string]Attack{
+	"Backdoor:EC2/C&CActivity":                                  {[]string{"TA0011"}, []string{"T1071"}},
+	"Backdoor:EC2/DenialOfService":                              {[]string{"TA0040"}, []string{"T1498"}},
+	"Backdoor:EC2/Spambot":                                      {[]string{"TA0040"}, []string{"T1496"}},
+	"Backdoor:Lambda/C&CActivity":                               {[]string{"TA0011"}, []string{"T1071"}},
+	"Backdoor:Runtime/C&CActivity":                              {[]string{"TA0011"}, []string{"T1071"}},
+	"CryptoCurrency:EC2/BitcoinTool":                            {[]string{"TA0040"}, []string{"T1496"}},
+	"CryptoCurrency:Lambda/BitcoinTool":                         {[]string{"TA0040"}, []string{"T1496"}},
+	"CryptoCurrency:Runtime/BitcoinTool":                        {[]string{"TA0040"}, []string{"T1496"}},
+	"Discovery:S3/MaliciousIPCaller":                            {[]string{"TA0007"}, []string{"T1619"}},
+	"Execution:Kubernetes/ExecInKubeSystemPod":                  {[]string{"TA0002"}, []string{"T1609"}},
+	"Exfiltration:S3/AnomalousBehavior":                         {[]string{"TA0009", "TA0010"}, []string{"T1530"}},
+	"Exfiltration:S3/MaliciousIPCaller":                         {[]string{"TA0009", "TA0010"}, []string{"T1530"}},
+	"Impact:S3/MaliciousIPCaller":                               {[]string{"TA0040"}, []string{"T1485"}},
+	"PrivilegeEscalation:Kubernetes/PrivilegedContainer":        {[]string{"TA0004"}, []string{"T1611"}},
+	"PrivilegeEscalation:Runtime/ContainerMountsHostDirectory":  {[]string{"TA0004"}, []string{"T1611"}},
+	"Recon:EC2/PortProbeEMRUnprotectedPort":                     {[]string{"TA0043"}, []string{"T1595"}},
+	"Recon:EC2/PortProbeUnprotectedPort":                        {[]string{"TA0043"}, []string{"T1595"}},
+	"Recon:EC2/Portscan":                                        {[]string{"TA0007"}, []string{"T1046"}},
+	"Recon:IAMUser/MaliciousIPCaller":                           {[]string{"TA0007"}, []string{"T1526"}},
+	"Recon:IAMUser/TorIPCaller":                                 {[]string{"TA0007"}, []string{"T1526"}},
+	"Stealth:IAMUser/CloudTrailLoggingDisabled":                 {[]string{"TA0005"}, []string{"T1562.008"}},
+	"Stealth:IAMUser/PasswordPolicyChange":                      {[]string{"TA0005"}, []string{"T1562"}},
+	"Stealth:S3/ServerAccessLoggingDisabled":                    {[]string{"TA0005"}, []string{"T1562.008"}},
+	"Trojan:EC2/BlackholeTraffic":                               {[]string{"TA0011"}, []string{"T1071"}},
+	"Trojan:EC2/DGADomainRequest":                               {[]string{"TA0011"}, []string{"T1568.002"}},
+	"Trojan:EC2/DNSDataExfiltration":                            {[]string{"TA0010"}, []string{"T1048"}},
+	"Trojan:EC2/DropPoint":                                      {[]string{"TA0011"}, []string{"T1071"}},
+	"UnauthorizedAccess:EC2/MaliciousIPCaller":                  {[]string{"TA0011"}, []string{"T1071"}},
+	"UnauthorizedAccess:EC2/MetadataDNSRebind":                  {[]string{"TA0006"}, []string{"T1552.005"}},
+	"UnauthorizedAccess:EC2/RDPBruteForce":                      {[]string{"TA0006"}, []string{"T1110"}},
+	"UnauthorizedAccess:EC2/SSHBruteForce":                      {[]string{"TA0006"}, []string{"T1110"}},
+	"UnauthorizedAccess:EC2/TorClient":                          {[]string{"TA0011"}, []string{"T1090.003"}},
+	"UnauthorizedAccess:EC2/TorRelay":                           {[]string{"TA0011"}, []string{"T1090.003"}},
+	"UnauthorizedAccess:IAMUser/ConsoleLoginSuccess":            {[]string{"TA0001"}, []string{"T1078.004"}},
+	"UnauthorizedAccess:IAMUser/InstanceCredentialExfiltration": {[]string{"TA0001", "TA0006"}, []string{"T1078.004", "T1552.005"}},
+	"UnauthorizedAccess:IAMUser/MaliciousIPCaller":              {[]string{"TA0001"}, []string{"T1078.004"}},
+	"UnauthorizedAccess:IAMUser/TorIPCaller":                    {[]string{"TA0001"}, []string{"T1078.004"}},
+}
+
+// attackByPurpose is the fallback for types not in attackByType. GuardDuty's own purposes mostly line up with ATT&CK
+// tactics, but the technique is only given where nearly every finding with that purpose uses it. Pentest and Policy
+// findings aren't attacker behavior so they have no mapping.
+var attackByPurpose = map[string]Attack{
+	"Backdoor":            {[]string{"TA0011"}, nil},
+	"Behavior":            {[]string{"TA0011"}, nil},
+	"CredentialAccess":    {[]string{"TA0006"}, nil},
+	"CryptoCurrency":      {[]string{"TA0040"}, []string{"T1496"}},
+	"DefenseEvasion":      {[]string{"TA0005"}, nil},
+	"Discovery":           {[]string{"TA0007"}, nil},
+	"Execution":           {[]string{"TA0002"}, nil},
+	"Exfiltration":        {[]string{"TA0010"}, nil},
+	"Impact":              {[]string{"TA0040"}, nil},
+	"InitialAccess":       {[]string{"TA0001"}, nil},
+	"Persistence":         {[]string{"TA0003"}, nil},
+	"PrivilegeEscalation": {[]string{"TA0004"}, nil},
+	"Recon":               {[]string{"TA0043"}, nil},
+	"Stealth":             {[]string{"TA0005"}, nil},
+	"Trojan":              {[]string{"TA0011"}, nil},
+	"UnauthorizedAccess":  {[]string{"TA0001"}, nil},
+}
+
+// AttackFor looks up the ATT&CK mapping for a finding type, the zero Attack means there isn't one.
+func AttackFor(t FindingType) Attack {
+	if a, ok := attackByType[t.key()]; ok {
+		return a
+	}
+	return attackByPurpose[t.ThreatPurpose]
+}
+
+// addType populates the severity label and the parts of the finding type, then maps it to ATT&CK
+func (l *LogEntry) addType() {
+	l.SeverityLabel = SeverityLabel(l.Severity)
+	t := ParseType(l.EventType)
+	l.ThreatPurpose = t.ThreatPurpose
+	l.ThreatResource = t.ResourceType
+	l.ThreatFamily = t.ThreatFamily
+	l.DetectionMechanism = t.DetectionMechanism
+	l.Artifact = t.Artifact
+	a := AttackFor(t)
+	l.MitreTactics = a.Tactics
+	l.MitreTechniques = a.Techniques
+}
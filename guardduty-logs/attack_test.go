@@ -0,0 +1,43 @@
+package guarddutylogs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeverityLabel(t *testing.T) {
+	for sev, want := range map[float64]string{0: "", 0.5: "", 1: "Low", 3.9: "Low", 4: "Medium", 6.9: "Medium", 7: "High", 8.9: "High", 9: "Critical", 10: "Critical"} {
+		if got := SeverityLabel(sev); got != want {
+			t.Errorf("SeverityLabel(%v) = %q, want %q", sev, got, want)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for s, want := range map[string]FindingType{
+		"Recon:EC2/PortProbeUnprotectedPort":   {"Recon", "EC2", "PortProbeUnprotectedPort", "", ""},
+		"Backdoor:EC2/C&CActivity.B!DNS":       {"Backdoor", "EC2", "C&CActivity", "B", "DNS"},
+		"Trojan:EC2/DNSDataExfiltration!DNS":   {"Trojan", "EC2", "DNSDataExfiltration", "", "DNS"},
+		"UnauthorizedAccess:EC2/TorClient":     {"UnauthorizedAccess", "EC2", "TorClient", "", ""},
+		"CryptoCurrency:Runtime/BitcoinTool.B": {"CryptoCurrency", "Runtime", "BitcoinTool", "B", ""},
+		"Policy":                               {},
+		"Policy:S3":                            {ThreatPurpose: "Policy", ResourceType: "S3"},
+	} {
+		if got := ParseType(s); got != want {
+			t.Errorf("ParseType(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+}
+
+func TestAttackFor(t *testing.T) {
+	for s, want := range map[string]Attack{
+		"Backdoor:EC2/C&CActivity.B!DNS":         {[]string{"TA0011"}, []string{"T1071"}},
+		"UnauthorizedAccess:EC2/TorClient":       {[]string{"TA0011"}, []string{"T1090.003"}},
+		"Execution:Runtime/NewBinaryExecuted":    {[]string{"TA0002"}, nil},
+		"Policy:S3/BucketAnonymousAccessGranted": {},
+	} {
+		if got := AttackFor(ParseType(s)); !reflect.DeepEqual(got, want) {
+			t.Errorf("AttackFor(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+}
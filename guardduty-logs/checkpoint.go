@@ -0,0 +1,46 @@
+package guarddutylogs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"time"
+)
+
+// Checkpoint keeps the updatedAt of the newest finding collected by a Poller in an SSM parameter.
+type Checkpoint struct {
+	SSM  ssmiface.SSMAPI
+	Name string
+}
+
+// NewCheckpoint returns a Checkpoint stored in the named parameter.
+func NewCheckpoint(svc ssmiface.SSMAPI, name string) *Checkpoint {
+	return &Checkpoint{SSM: svc, Name: name}
+}
+
+// Load returns the saved time, or the zero time if the parameter doesn't exist yet.
+func (c *Checkpoint) Load() (time.Time, error) {
+	out, err := c.SSM.GetParameter(&ssm.GetParameterInput{Name: aws.String(c.Name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	if out.Parameter == nil || aws.StringValue(out.Parameter.Value) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, aws.StringValue(out.Parameter.Value))
+}
+
+// Save persists t.
+func (c *Checkpoint) Save(t time.Time) error {
+	_, err := c.SSM.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(c.Name),
+		Overwrite: aws.Bool(true),
+		Type:      aws.String("String"),
+		Value:     aws.String(t.UTC().Format(time.RFC3339Nano)),
+	})
+	return err
+}
@@ -0,0 +1,217 @@
+package guarddutylogs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxKeys is how many detail keys a Deduper keeps per finding, at 32 characters each it leaves plenty of room
+// under DynamoDB's 400 KB item limit.
+const DefaultMaxKeys = 1000
+
+// FindingState is what a Deduper remembers about a finding: the last count and a key for each log entry already
+// emitted, oldest first.
+type FindingState struct {
+	Count int64
+	Keys  []string
+}
+
+// DedupStore persists FindingState between invocations. Get returns nil if the finding hasn't been seen.
+type DedupStore interface {
+	Get(id string) (*FindingState, error)
+	Put(id string, state *FindingState) error
+}
+
+// Deduper drops log entries that were already emitted for an earlier update of the same finding. A nil Deduper
+// passes everything through.
+type Deduper struct {
+	Store DedupStore
+	// MaxKeys caps the keys remembered for a finding, the ones least recently seen are forgotten first. Zero means
+	// no limit.
+	MaxKeys int
+}
+
+// NewDeduper returns a Deduper using store that keeps DefaultMaxKeys per finding.
+func NewDeduper(store DedupStore) *Deduper {
+	return &Deduper{Store: store, MaxKeys: DefaultMaxKeys}
+}
+
+// Filter takes the log entries from NewLogs for a single finding and returns only the ones not seen before, for
+// example new probe details on a PORT_PROBE finding. If nothing is new but the count went up, a single compact
+// entry with only the common finding fields, the count and CountDelta is returned instead.
+func (d *Deduper) Filter(logs []LogEntry) ([]LogEntry, error) {
+	if d == nil || len(logs) == 0 {
+		return logs, nil
+	}
+	id := logs[0].Id
+	prev, err := d.Store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	if prev != nil {
+		for _, k := range prev.Keys {
+			seen[k] = true
+		}
+	}
+
+	// keys in this update move to the end, so the ones that age out are for details GuardDuty stopped reporting
+	current := make(map[string]bool)
+	keys := make([]string, 0)
+	fresh := make([]LogEntry, 0)
+	for _, l := range logs {
+		k := detailKey(l)
+		if !current[k] {
+			current[k] = true
+			keys = append(keys, k)
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if prev != nil {
+			l.CountDelta = l.Count - prev.Count
+		}
+		fresh = append(fresh, l)
+	}
+	state := &FindingState{Count: logs[0].Count}
+	if prev != nil {
+		for _, k := range prev.Keys {
+			if !current[k] {
+				state.Keys = append(state.Keys, k)
+			}
+		}
+	}
+	state.Keys = append(state.Keys, keys...)
+	if d.MaxKeys > 0 && len(state.Keys) > d.MaxKeys {
+		state.Keys = state.Keys[len(state.Keys)-d.MaxKeys:]
+	}
+	if len(fresh) == 0 && prev != nil && state.Count != prev.Count {
+		fresh = append(fresh, logs[0].updated(prev.Count))
+	}
+	if prev == nil || len(fresh) > 0 {
+		if err = d.Store.Put(id, state); err != nil {
+			return nil, err
+		}
+	}
+	return fresh, nil
+}
+
+// updated returns the compact "finding updated" entry.
+func (l LogEntry) updated(prevCount int64) LogEntry {
+	return LogEntry{
+		AccountId:      l.AccountId,
+		Arn:            l.Arn,
+		Id:             l.Id,
+		Partition:      l.Partition,
+		Region:         l.Region,
+		Severity:       l.Severity,
+		SeverityLabel:  l.SeverityLabel,
+		Title:          l.Title,
+		EventType:      l.EventType,
+		UpdatedAt:      l.UpdatedAt,
+		ResourceType:   l.ResourceType,
+		ActionType:     l.ActionType,
+		Count:          l.Count,
+		CountDelta:     l.Count - prevCount,
+		EventLastSeen:  l.EventLastSeen,
+		FindingUpdated: true,
+		Suppressed:     l.Suppressed,
+		SuppressedBy:   l.SuppressedBy,
+	}
+}
+
+// detailKey identifies the probe, connection or login in a log entry. Anything else, like the severity, the instance's
+// state or tags, can change between updates without it being new activity. The RDS user and application are included
+// because each login attribute is a separate entry with the same addresses.
+func detailKey(l LogEntry) string {
+	parts := []string{
+		l.Id, l.ActionType, l.ConnectionDirection, l.ConnectionProtocol,
+		l.LocalIp, strconv.FormatInt(l.LocalPort, 10), l.RemoteIp, strconv.FormatInt(l.RemotePort, 10),
+		l.RdsLoginUser, l.RdsLoginApplication,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// MemoryStore is a DedupStore that only lasts as long as the process, useful for tests and for a warm Lambda.
+type MemoryStore struct {
+	mux    sync.Mutex
+	states map[string]*FindingState
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: make(map[string]*FindingState)}
+}
+
+func (m *MemoryStore) Get(id string) (*FindingState, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.states[id], nil
+}
+
+func (m *MemoryStore) Put(id string, state *FindingState) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.states[id] = state
+	return nil
+}
+
+// DynamoStore is a DedupStore backed by a DynamoDB table with a string partition key named "id".
+type DynamoStore struct {
+	DynamoDB dynamodbiface.DynamoDBAPI
+	Table    string
+}
+
+// NewDynamoStore returns a DynamoStore using table.
+func NewDynamoStore(svc dynamodbiface.DynamoDBAPI, table string) *DynamoStore {
+	return &DynamoStore{DynamoDB: svc, Table: table}
+}
+
+func (d *DynamoStore) Get(id string) (*FindingState, error) {
+	out, err := d.DynamoDB.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(d.Table),
+		Key:            map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(out.Item) == 0 {
+		return nil, err
+	}
+	state := &FindingState{}
+	if c := out.Item["count"]; c != nil && c.N != nil {
+		state.Count, _ = strconv.ParseInt(aws.StringValue(c.N), 10, 64)
+	}
+	if k := out.Item["keys"]; k != nil {
+		// a list keeps the order MaxKeys needs
+		for _, v := range k.L {
+			if v != nil && v.S != nil {
+				state.Keys = append(state.Keys, aws.StringValue(v.S))
+			}
+		}
+	}
+	return state, nil
+}
+
+func (d *DynamoStore) Put(id string, state *FindingState) error {
+	item := map[string]*dynamodb.AttributeValue{
+		"id":    {S: aws.String(id)},
+		"count": {N: aws.String(strconv.FormatInt(state.Count, 10))},
+	}
+	keys := make([]*dynamodb.AttributeValue, 0, len(state.Keys))
+	for _, k := range state.Keys {
+		keys = append(keys, &dynamodb.AttributeValue{S: aws.String(k)})
+	}
+	item["keys"] = &dynamodb.AttributeValue{L: keys}
+	_, err := d.DynamoDB.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(d.Table),
+		Item:      item,
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package guarddutylogs
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"testing"
+)
+
+func TestDeduper(t *testing.T) {
+	cwEvent := &events.CloudWatchEvent{}
+	if err := json.Unmarshal([]byte(rawEvents[0]), cwEvent); err != nil {
+		t.Fatal(err)
+	}
+	finding, err := ParseEvent(&cwEvent.Detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDeduper(NewMemoryStore())
+	filter := func() []LogEntry {
+		logs, err := NewLogs(finding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fresh, err := d.Filter(logs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fresh
+	}
+
+	if logs := filter(); len(logs) != 2 {
+		t.Fatalf("expected both probes the first time, got %d", len(logs))
+	}
+
+	// same probes, more activity: just the compact update
+	finding.Service.Count = aws.Int64(1310)
+	finding.UpdatedAt = aws.String("2019-08-30T03:11:22.241Z")
+	logs := filter()
+	if len(logs) != 1 || !logs[0].FindingUpdated || logs[0].CountDelta != 2 || logs[0].SrcIp != "" {
+		t.Fatalf("expected a compact update with a delta of 2, got %+v", logs)
+	}
+
+	// nothing changed at all
+	if logs = filter(); len(logs) != 0 {
+		t.Fatalf("expected nothing for an unchanged finding, got %+v", logs)
+	}
+
+	// a new probe from another address is the only thing emitted
+	probes := finding.Service.Action.PortProbeAction
+	probes.PortProbeDetails = append(probes.PortProbeDetails, &guardduty.PortProbeDetail{
+		LocalPortDetails: &guardduty.LocalPortDetails{Port: aws.Int64(3389)},
+		RemoteIpDetails:  &guardduty.RemoteIpDetails{IpAddressV4: aws.String("198.51.100.7")},
+	})
+	finding.Service.Count = aws.Int64(1311)
+	logs = filter()
+	if len(logs) != 1 || logs[0].SrcIp != "198.51.100.7" || logs[0].CountDelta != 1 || logs[0].FindingUpdated {
+		t.Fatalf("expected only the new probe, got %+v", logs)
+	}
+
+	var nilDeduper *Deduper
+	if logs, _ = nilDeduper.Filter(make([]LogEntry, 3)); len(logs) != 3 {
+		t.Error("expected a nil Deduper to pass everything through")
+	}
+}
+
+func TestDeduperStableKeys(t *testing.T) {
+	cwEvent := &events.CloudWatchEvent{}
+	if err := json.Unmarshal([]byte(rawEvents[0]), cwEvent); err != nil {
+		t.Fatal(err)
+	}
+	finding, err := ParseEvent(&cwEvent.Detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := finding.Resource.InstanceDetails
+	for _, ip := range []string{"10.0.1.5", "10.0.2.5", "10.0.3.5"} {
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, &guardduty.NetworkInterface{
+			PrivateIpAddress: aws.String(ip),
+			PublicIp:         aws.String("203.0.113." + ip[5:6]),
+			SubnetId:         aws.String("subnet-" + ip[5:6]),
+		})
+	}
+	d := NewDeduper(NewMemoryStore())
+	emitted := 0
+	for i := 0; i < 20; i++ {
+		// things that change between updates without any new activity
+		finding.Severity = aws.Float64(float64(2 + i%3))
+		instance.InstanceState = aws.String([]string{"running", "stopped"}[i%2])
+		logs, err := NewLogs(finding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fresh, err := d.Filter(logs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitted += len(fresh)
+	}
+	if emitted != 2 {
+		t.Errorf("expected only the two probes from the first update, got %d entries", emitted)
+	}
+}
+
+func TestDeduperMaxKeys(t *testing.T) {
+	store := NewMemoryStore()
+	d := &Deduper{Store: store, MaxKeys: 3}
+	for i := 0; i < 5; i++ {
+		fresh, err := d.Filter([]LogEntry{{Id: "f", ActionType: "PORT_PROBE", LocalPort: int64(i)}, {Id: "f", ActionType: "PORT_PROBE"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && len(fresh) != 1 {
+			t.Errorf("update %d: expected only the new port, got %d entries", i, len(fresh))
+		}
+	}
+	state, _ := store.Get("f")
+	if len(state.Keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(state.Keys))
+	}
+	// port 0 is in every update so it was never forgotten
+	if state.Keys[2] != detailKey(LogEntry{Id: "f", ActionType: "PORT_PROBE"}) {
+		t.Error("expected the key seen in the latest update to be kept")
+	}
+}
@@ -2,8 +2,13 @@ package guarddutylogs
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/blockpane/logsuck/internal/flatten"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"sort"
 	"strings"
 )
 
@@ -23,6 +28,16 @@ type LogEntry struct {
 	UpdatedAt    string  `json:"updated_at,omitempty"`
 	ResourceType string  `json:"resource_type,omitempty"`
 
+	// Parsed from Severity and EventType, ThreatResource is the resource type in the finding type, EC2 or IAMUser
+	SeverityLabel      string   `json:"severity_label,omitempty"`
+	ThreatPurpose      string   `json:"threat_purpose,omitempty"`
+	ThreatResource     string   `json:"threat_resource,omitempty"`
+	ThreatFamily       string   `json:"threat_family,omitempty"`
+	DetectionMechanism string   `json:"detection_mechanism,omitempty"`
+	Artifact           string   `json:"artifact,omitempty"`
+	MitreTactics       []string `json:"mitre_tactics,omitempty"`
+	MitreTechniques    []string `json:"mitre_techniques,omitempty"`
+
 	// InstanceDetails Resource
 	InstanceAz         string            `json:"instance_az,omitempty"`
 	InstanceDesc       string            `json:"instance_desc,omitempty"`
@@ -33,10 +48,13 @@ type LogEntry struct {
 	InstanceLaunchTime string            `json:"instance_launch_time,omitempty"`
 	InstancePrivateIp  []string          `json:"instance_private_ip,omitempty"`
 	InstancePublicIp   []string          `json:"instance_public_ip,omitempty"`
+	InstanceIpv6       []string          `json:"instance_ipv6,omitempty"`
 	InstanceSubnet     []string          `json:"instance_subnet,omitempty"`
 	InstanceVpc        string            `json:"instance_vpc,omitempty"`
 	InstanceSg         map[string]string `json:"instance_sg,omitempty"`
 	InstanceTags       map[string]string `json:"instance_tags,omitempty"`
+	InstanceProfileArn string            `json:"instance_profile_arn,omitempty"`
+	InstanceProfileId  string            `json:"instance_profile_id,omitempty"`
 
 	// AccessKeyDetails Resource
 	AccessKeyId string `json:"access_key_id,omitempty"`
@@ -44,6 +62,70 @@ type LogEntry struct {
 	UserName    string `json:"username,omitempty"`
 	UserType    string `json:"user_type,omitempty"`
 
+	// Tags on any resource other than an instance
+	ResourceTags map[string]string `json:"resource_tags,omitempty"`
+
+	// S3BucketDetails Resource, there can be more than one bucket in a finding
+	S3BucketName   []string `json:"s3_bucket_name,omitempty"`
+	S3BucketArn    []string `json:"s3_bucket_arn,omitempty"`
+	S3BucketType   []string `json:"s3_bucket_type,omitempty"`
+	S3BucketOwner  []string `json:"s3_bucket_owner,omitempty"`
+	S3BucketPublic []string `json:"s3_bucket_public,omitempty"`
+	S3ObjectKey    []string `json:"s3_object_key,omitempty"`
+
+	// EksClusterDetails Resource
+	EksClusterName   string `json:"eks_cluster_name,omitempty"`
+	EksClusterArn    string `json:"eks_cluster_arn,omitempty"`
+	EksClusterStatus string `json:"eks_cluster_status,omitempty"`
+	EksClusterVpc    string `json:"eks_cluster_vpc,omitempty"`
+
+	// KubernetesDetails Resource
+	K8sUser              string   `json:"k8s_user,omitempty"`
+	K8sUserUid           string   `json:"k8s_user_uid,omitempty"`
+	K8sGroups            []string `json:"k8s_groups,omitempty"`
+	K8sImpersonatedUser  string   `json:"k8s_impersonated_user,omitempty"`
+	K8sWorkloadName      string   `json:"k8s_workload_name,omitempty"`
+	K8sWorkloadNamespace string   `json:"k8s_workload_namespace,omitempty"`
+	K8sWorkloadType      string   `json:"k8s_workload_type,omitempty"`
+	K8sServiceAccount    string   `json:"k8s_service_account,omitempty"`
+	K8sHostNetwork       bool     `json:"k8s_host_network,omitempty"`
+
+	// EcsClusterDetails Resource
+	EcsClusterName   string `json:"ecs_cluster_name,omitempty"`
+	EcsClusterArn    string `json:"ecs_cluster_arn,omitempty"`
+	EcsClusterStatus string `json:"ecs_cluster_status,omitempty"`
+	EcsTaskArn       string `json:"ecs_task_arn,omitempty"`
+	EcsTaskDef       string `json:"ecs_task_definition,omitempty"`
+
+	// Containers from ContainerDetails, Kubernetes workloads or ECS tasks
+	ContainerId    []string `json:"container_id,omitempty"`
+	ContainerName  []string `json:"container_name,omitempty"`
+	ContainerImage []string `json:"container_image,omitempty"`
+
+	// LambdaDetails Resource
+	LambdaName    string `json:"lambda_name,omitempty"`
+	LambdaArn     string `json:"lambda_arn,omitempty"`
+	LambdaVersion string `json:"lambda_version,omitempty"`
+	LambdaRole    string `json:"lambda_role,omitempty"`
+	LambdaVpc     string `json:"lambda_vpc,omitempty"`
+
+	// RdsDbInstanceDetails Resource
+	RdsInstanceId    string `json:"rds_instance_id,omitempty"`
+	RdsInstanceArn   string `json:"rds_instance_arn,omitempty"`
+	RdsClusterId     string `json:"rds_cluster_id,omitempty"`
+	RdsEngine        string `json:"rds_engine,omitempty"`
+	RdsEngineVersion string `json:"rds_engine_version,omitempty"`
+
+	// RdsDbUserDetails Resource
+	RdsUser        string `json:"rds_user,omitempty"`
+	RdsApplication string `json:"rds_application,omitempty"`
+	RdsDatabase    string `json:"rds_database,omitempty"`
+	RdsAuthMethod  string `json:"rds_auth_method,omitempty"`
+	RdsSsl         string `json:"rds_ssl,omitempty"`
+
+	// EbsVolumeDetails Resource
+	EbsVolumeArn []string `json:"ebs_volume_arn,omitempty"`
+
 	// Common values for Action
 	// can be multiple actions in a single finding, should loop and create unique event for each:
 	Archived       bool     `json:"archived,omitempty"`
@@ -55,16 +137,75 @@ type LogEntry struct {
 	ServiceName    string   `json:"service_name,omitempty"`
 	UserFeedBack   string   `json:"user_feed_back,omitempty"`
 	Evidence       []string `json:"evidence,omitempty"`
-	ActionType     string   `json:"action_type,omitempty"`
+
+	// Evidence.ThreatIntelligenceDetails and the threat in additionalInfo, so analysts can pivot on the source
+	ThreatListNames []string          `json:"threat_list_names,omitempty"`
+	ThreatNames     []string          `json:"threat_names,omitempty"`
+	AdditionalInfo  map[string]string `json:"additional_info,omitempty"`
+	ActionType      string            `json:"action_type,omitempty"`
+	FeatureName     string            `json:"feature_name,omitempty"`
+
+	// Set by a Deduper: how much the count went up since the last update that was logged, and if this is only a
+	// compact "finding updated" entry because no new details were found.
+	CountDelta     int64 `json:"count_delta,omitempty"`
+	FindingUpdated bool  `json:"finding_updated,omitempty"`
+
+	// Set by a Suppressor when a tag or archive rule matched, SuppressedBy is the rule's name
+	Suppressed   bool   `json:"suppressed,omitempty"`
+	SuppressedBy string `json:"suppressed_by,omitempty"`
 
 	// AwsApiCallAction
 	Api            string `json:"api,omitempty"`
 	CallerType     string `json:"caller_type,omitempty"`
 	Domain         string `json:"domain,omitempty"`
-	ApiServiceName string `json:"service_name,omitempty"`
+	ApiServiceName string `json:"api_service_name,omitempty"`
+
+	ApiAffectedResources map[string]string `json:"api_affected_resources,omitempty"`
+	ApiErrorCode         string            `json:"api_error_code,omitempty"`
+	UserAgent            string            `json:"user_agent,omitempty"`
 
 	// DnsRequestAction
-	DnsDomain string `json:"dns_domain,omitempty"`
+	DnsDomain  string `json:"dns_domain,omitempty"`
+	DnsBlocked bool   `json:"dns_blocked,omitempty"`
+
+	// KubernetesApiCallAction
+	K8sVerb         string   `json:"k8s_verb,omitempty"`
+	K8sRequestUri   string   `json:"k8s_request_uri,omitempty"`
+	K8sResource     string   `json:"k8s_resource,omitempty"`
+	K8sResourceName string   `json:"k8s_resource_name,omitempty"`
+	K8sSubresource  string   `json:"k8s_subresource,omitempty"`
+	K8sNamespace    string   `json:"k8s_namespace,omitempty"`
+	K8sStatusCode   int64    `json:"k8s_status_code,omitempty"`
+	K8sParameters   string   `json:"k8s_parameters,omitempty"`
+	K8sSourceIps    []string `json:"k8s_source_ips,omitempty"`
+	K8sAllowed      *bool    `json:"k8s_allowed,omitempty"`
+	K8sRoleKind     string   `json:"k8s_role_kind,omitempty"`
+	K8sRoleName     string   `json:"k8s_role_name,omitempty"`
+	K8sRoleBinding  string   `json:"k8s_role_binding,omitempty"`
+	K8sRoleRefKind  string   `json:"k8s_role_ref_kind,omitempty"`
+	K8sRoleRefName  string   `json:"k8s_role_ref_name,omitempty"`
+
+	// RdsLoginAttemptAction, one log per login attribute
+	RdsLoginUser        string `json:"rds_login_user,omitempty"`
+	RdsLoginApplication string `json:"rds_login_application,omitempty"`
+	RdsLoginFailed      int64  `json:"rds_login_failed,omitempty"`
+	RdsLoginSucceeded   int64  `json:"rds_login_succeeded,omitempty"`
+
+	// RuntimeDetails (Runtime Monitoring findings)
+	ProcessName     string `json:"process_name,omitempty"`
+	ProcessPath     string `json:"process_path,omitempty"`
+	ProcessSha256   string `json:"process_sha256,omitempty"`
+	ProcessPid      int64  `json:"process_pid,omitempty"`
+	ProcessUser     string `json:"process_user,omitempty"`
+	RuntimeCommand  string `json:"runtime_command,omitempty"`
+	RuntimeTool     string `json:"runtime_tool,omitempty"`
+	RuntimeToolType string `json:"runtime_tool_category,omitempty"`
+	RuntimeFilePath string `json:"runtime_file_path,omitempty"`
+
+	// EbsVolumeScanDetails and MalwareScanDetails (Malware Protection findings)
+	MalwareScanId      string   `json:"malware_scan_id,omitempty"`
+	MalwareScanType    string   `json:"malware_scan_type,omitempty"`
+	MalwareThreatNames []string `json:"malware_threat_names,omitempty"`
 
 	// PortProbeAction
 	PortProbeBLocked bool   `json:"port_probe_b_locked,omitempty"`
@@ -76,16 +217,26 @@ type LogEntry struct {
 	ConnectionDirection string `json:"connection_direction,omitempty"`
 	ConnectionProtocol  string `json:"connection_protocol,omitempty"`
 
-	// LocalPortDetails can be shared across ActionTypes
-	DestPort     int64  `json:"dest_port,omitempty"`
-	DestPortName string `json:"dest_port_name,omitempty"`
+	// LocalIpDetails and LocalPortDetails, the resource's side of the activity. If the finding doesn't include
+	// the local IP the instance's primary private IP is used.
+	LocalIp       string `json:"local_ip,omitempty"`
+	LocalPort     int64  `json:"local_port,omitempty"`
+	LocalPortName string `json:"local_port_name,omitempty"`
 
-	// RemotePortDetails ... also shared
-	SrcPort     int64  `json:"src_port,omitempty"`
-	SrcPortName string `json:"src_port_name,omitempty"`
+	// RemoteIpDetails and RemotePortDetails can be shared across ActionTypes
+	RemoteIp        string  `json:"remote_ip,omitempty"`
+	RemotePort      int64   `json:"remote_port,omitempty"`
+	RemotePortName  string  `json:"remote_port_name,omitempty"`
+	RemoteIpCity    string  `json:"remote_ip_city,omitempty"`
+	RemoteIpCountry string  `json:"remote_ip_country,omitempty"`
+	RemoteIpLat     float64 `json:"remote_ip_lat,omitempty"`
+	RemoteIpLon     float64 `json:"remote_ip_long,omitempty"`
+	RemoteIpAsn     string  `json:"remote_ip_org_asn,omitempty"`
+	RemoteIpOrg     string  `json:"remote_ip_org,omitempty"`
+	RemoteIpIsp     string  `json:"remote_ip_isp,omitempty"`
 
-	// RemoteIpDetails can be shared across ActionTypes
-	SrcIp        string  `json:"src_ip,omitempty"`
+	// The remote IP's location and organization under the names used before the fields above, so existing searches
+	// keep working. They always describe the remote side, even for outbound connections where it's the destination.
 	SrcIpCity    string  `json:"src_ip_city,omitempty"`
 	SrcIpCountry string  `json:"src_ip_country,omitempty"`
 	SrcIpLat     float64 `json:"src_ip_lat,omitempty"`
@@ -93,6 +244,19 @@ type LogEntry struct {
 	SrcIpAsn     string  `json:"src_ip_org_asn,omitempty"`
 	SrcIpOrg     string  `json:"src_ip_org,omitempty"`
 	SrcIpIsp     string  `json:"src_ip_isp,omitempty"`
+
+	// Source and destination are the local and remote sides swapped around according to the direction of the
+	// connection, or for actions without a direction, the resource role.
+	SrcIp        string `json:"src_ip,omitempty"`
+	SrcPort      int64  `json:"src_port,omitempty"`
+	SrcPortName  string `json:"src_port_name,omitempty"`
+	DestIp       string `json:"dest_ip,omitempty"`
+	DestPort     int64  `json:"dest_port,omitempty"`
+	DestPortName string `json:"dest_port_name,omitempty"`
+
+	// SrcIpVersion and DestIpVersion are 4 or 6
+	SrcIpVersion  int `json:"src_ip_version,omitempty"`
+	DestIpVersion int `json:"dest_ip_version,omitempty"`
 }
 
 // addCommon populates information present in every finding
@@ -108,8 +272,7 @@ func (l *LogEntry) addCommon(f *guardduty.Finding) {
 	l.Title = aws.StringValue(f.Title)
 	l.EventType = aws.StringValue(f.Type)
 	l.UpdatedAt = aws.StringValue(f.UpdatedAt)
-	l.ResourceType = aws.StringValue(f.Resource.ResourceType)
-
+	l.addType()
 }
 
 // addCommonService populates information present in every action
@@ -122,9 +285,15 @@ func (l *LogEntry) addCommonService(a *guardduty.Service) {
 	l.ResourceRole = aws.StringValue(a.ResourceRole)
 	l.ServiceName = aws.StringValue(a.ServiceName)
 	l.UserFeedBack = aws.StringValue(a.UserFeedback)
-	l.ActionType = aws.StringValue(a.Action.ActionType)
+	l.FeatureName = aws.StringValue(a.FeatureName)
+	if a.Action != nil {
+		l.ActionType = aws.StringValue(a.Action.ActionType)
+	}
 	if a.Evidence != nil {
 		for _, ti := range a.Evidence.ThreatIntelligenceDetails {
+			if ti == nil {
+				continue
+			}
 			names := make([]string, 0)
 			for _, n := range ti.ThreatNames {
 				names = append(names, aws.StringValue(n))
@@ -134,8 +303,52 @@ func (l *LogEntry) addCommonService(a *guardduty.Service) {
 				l.Evidence,
 				aws.StringValue(ti.ThreatListName)+": "+threats,
 			)
+			l.addThreat(aws.StringValue(ti.ThreatListName), names...)
+		}
+	}
+	l.addAdditionalInfo(a.AdditionalInfo)
+}
+
+// addAdditionalInfo flattens the service's additionalInfo into AdditionalInfo with dotted keys. GetFindings returns
+// it as a JSON string in Value, ParseEvent puts EventBridge's raw object there too.
+func (l *LogEntry) addAdditionalInfo(info *guardduty.ServiceAdditionalInfo) {
+	if info == nil || aws.StringValue(info.Value) == "" {
+		return
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(aws.StringValue(info.Value)), &m); err != nil {
+		l.AdditionalInfo = map[string]string{"value": aws.StringValue(info.Value)}
+		return
+	}
+	l.AdditionalInfo = make(map[string]string)
+	flatten.Map("", m, l.AdditionalInfo)
+	if len(l.AdditionalInfo) == 0 {
+		l.AdditionalInfo = nil
+		return
+	}
+	if name := l.AdditionalInfo["threatName"]; name != "" {
+		l.addThreat(l.AdditionalInfo["threatListName"], name)
+	}
+}
+
+// addThreat records a threat list and the threat names from it, skipping any already present
+func (l *LogEntry) addThreat(list string, names ...string) {
+	l.ThreatListNames = appendUnique(l.ThreatListNames, list)
+	for _, n := range names {
+		l.ThreatNames = appendUnique(l.ThreatNames, n)
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, v := range list {
+		if v == s {
+			return list
 		}
 	}
+	return append(list, s)
 }
 
 // addInstance populates information about the instance in a finding.
@@ -147,8 +360,15 @@ func (l *LogEntry) addInstance(i *guardduty.InstanceDetails) {
 	l.InstanceState = aws.StringValue(i.InstanceState)
 	l.InstanceType = aws.StringValue(i.InstanceType)
 	l.InstanceLaunchTime = aws.StringValue(i.LaunchTime)
+	if i.IamInstanceProfile != nil {
+		l.InstanceProfileArn = aws.StringValue(i.IamInstanceProfile.Arn)
+		l.InstanceProfileId = aws.StringValue(i.IamInstanceProfile.Id)
+	}
 	l.InstanceTags = make(map[string]string)
 	for _, t := range i.Tags {
+		if t == nil {
+			continue
+		}
 		l.InstanceTags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
 	}
 	// build list of public, private IP's and subnets:
@@ -156,27 +376,54 @@ func (l *LogEntry) addInstance(i *guardduty.InstanceDetails) {
 	prv := make(map[string]bool)
 	pub := make(map[string]bool)
 	sub := make(map[string]bool)
+	ipv6 := make(map[string]bool)
 	for _, in := range i.NetworkInterfaces {
+		if in == nil {
+			continue
+		}
+		if l.LocalIp == "" {
+			l.LocalIp, _ = ipaddr.Normalize(aws.StringValue(in.PrivateIpAddress))
+		}
+		for _, ip := range in.Ipv6Addresses {
+			if v6, _ := ipaddr.Normalize(aws.StringValue(ip)); v6 != "" {
+				ipv6[v6] = true
+			}
+		}
 		prv[aws.StringValue(in.PrivateIpAddress)] = true
 		for _, ip := range in.PrivateIpAddresses {
+			if ip == nil {
+				continue
+			}
 			prv[aws.StringValue(ip.PrivateIpAddress)] = true
 		}
 		pub[aws.StringValue(in.PublicIp)] = true
 		sub[aws.StringValue(in.SubnetId)] = true
 		l.InstanceVpc = aws.StringValue(in.VpcId)
 		for _, sg := range in.SecurityGroups {
+			if sg == nil {
+				continue
+			}
 			l.InstanceSg[aws.StringValue(sg.GroupId)] = aws.StringValue(sg.GroupName)
 		}
 	}
-	for k := range prv {
-		l.InstancePrivateIp = append(l.InstancePrivateIp, k)
-	}
-	for k := range pub {
-		l.InstancePublicIp = append(l.InstancePublicIp, k)
+	l.InstancePrivateIp = sortedKeys(prv)
+	l.InstancePublicIp = sortedKeys(pub)
+	l.InstanceSubnet = sortedKeys(sub)
+	l.InstanceIpv6 = sortedKeys(ipv6)
+}
+
+// sortedKeys returns the keys of a set sorted, so the same finding always gives the same log entry. It returns nil
+// for an empty set to keep the field out of the output.
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
 	}
-	for k := range sub {
-		l.InstanceSubnet = append(l.InstanceSubnet, k)
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
 }
 
 // addAccessKey populates information about the access key used in a finding.
@@ -195,36 +442,35 @@ func (l *LogEntry) addApiCall(a *guardduty.AwsApiCallAction) {
 		l.Domain = aws.StringValue(a.DomainDetails.Domain)
 	}
 	l.ApiServiceName = aws.StringValue(a.ServiceName)
-	l.SrcIp = aws.StringValue(a.RemoteIpDetails.IpAddressV4)
-	l.SrcIpCity = aws.StringValue(a.RemoteIpDetails.City.CityName)
-	l.SrcIpCountry = aws.StringValue(a.RemoteIpDetails.Country.CountryName)
-	l.SrcIpLat = aws.Float64Value(a.RemoteIpDetails.GeoLocation.Lat)
-	l.SrcIpLon = aws.Float64Value(a.RemoteIpDetails.GeoLocation.Lon)
-	l.SrcIpAsn = aws.StringValue(a.RemoteIpDetails.Organization.Asn)
-	l.SrcIpIsp = aws.StringValue(a.RemoteIpDetails.Organization.Isp)
-	l.SrcIpOrg = aws.StringValue(a.RemoteIpDetails.Organization.Org)
+	l.ApiErrorCode = aws.StringValue(a.ErrorCode)
+	for k, v := range a.AffectedResources {
+		if l.ApiAffectedResources == nil {
+			l.ApiAffectedResources = make(map[string]string)
+		}
+		l.ApiAffectedResources[k] = aws.StringValue(v)
+	}
+	l.UserAgent = aws.StringValue(a.UserAgent)
+	l.addRemoteIp(a.RemoteIpDetails)
+	l.setDirection(true)
 }
 
 // addDns populates information about suspicious DNS request
 func (l *LogEntry) addDns(d *guardduty.DnsRequestAction) {
 	l.DnsDomain = aws.StringValue(d.Domain)
+	l.DnsBlocked = aws.BoolValue(d.Blocked)
+	l.setDirection(false)
 }
 
 // addPortProbe populates information about incoming network attacks
 func (l *LogEntry) addPortProbe(p *guardduty.PortProbeAction, d *guardduty.PortProbeDetail) {
 	l.PortProbeBLocked = aws.BoolValue(p.Blocked)
-	l.DestPort = aws.Int64Value(d.LocalPortDetails.Port)
-	l.DestPortName = aws.StringValue(d.LocalPortDetails.PortName)
-	l.Port = aws.Int64Value(d.LocalPortDetails.Port)
-	l.PortName = aws.StringValue(d.LocalPortDetails.PortName)
-	l.SrcIp = aws.StringValue(d.RemoteIpDetails.IpAddressV4)
-	l.SrcIpCity = aws.StringValue(d.RemoteIpDetails.City.CityName)
-	l.SrcIpCountry = aws.StringValue(d.RemoteIpDetails.Country.CountryName)
-	l.SrcIpLat = aws.Float64Value(d.RemoteIpDetails.GeoLocation.Lat)
-	l.SrcIpLon = aws.Float64Value(d.RemoteIpDetails.GeoLocation.Lon)
-	l.SrcIpAsn = aws.StringValue(d.RemoteIpDetails.Organization.Asn)
-	l.SrcIpIsp = aws.StringValue(d.RemoteIpDetails.Organization.Isp)
-	l.SrcIpOrg = aws.StringValue(d.RemoteIpDetails.Organization.Org)
+	if d == nil {
+		return
+	}
+	l.addLocalIp(d.LocalIpDetails)
+	l.addLocalPort(d.LocalPortDetails)
+	l.addRemoteIp(d.RemoteIpDetails)
+	l.setDirection(true)
 }
 
 // addConnection populates information about suspicious outgoing network activity
@@ -232,69 +478,319 @@ func (l *LogEntry) addConnection(c *guardduty.NetworkConnectionAction) {
 	l.ConnectionBlocked = aws.BoolValue(c.Blocked)
 	l.ConnectionDirection = aws.StringValue(c.ConnectionDirection)
 	l.ConnectionProtocol = aws.StringValue(c.Protocol)
-	l.DestPort = aws.Int64Value(c.LocalPortDetails.Port)
-	l.DestPortName = aws.StringValue(c.LocalPortDetails.PortName)
-	l.Port = aws.Int64Value(c.LocalPortDetails.Port)
-	l.PortName = aws.StringValue(c.LocalPortDetails.PortName)
-	l.SrcIp = aws.StringValue(c.RemoteIpDetails.IpAddressV4)
-	l.SrcIpCity = aws.StringValue(c.RemoteIpDetails.City.CityName)
-	l.SrcIpCountry = aws.StringValue(c.RemoteIpDetails.Country.CountryName)
-	l.SrcIpLat = aws.Float64Value(c.RemoteIpDetails.GeoLocation.Lat)
-	l.SrcIpLon = aws.Float64Value(c.RemoteIpDetails.GeoLocation.Lon)
-	l.SrcIpAsn = aws.StringValue(c.RemoteIpDetails.Organization.Asn)
-	l.SrcIpIsp = aws.StringValue(c.RemoteIpDetails.Organization.Isp)
-	l.SrcIpOrg = aws.StringValue(c.RemoteIpDetails.Organization.Org)
+	l.addLocalIp(c.LocalIpDetails)
+	l.addLocalPort(c.LocalPortDetails)
+	l.addRemoteIp(c.RemoteIpDetails)
+	l.addRemotePort(c.RemotePortDetails)
+	l.setDirection(l.inbound())
+}
+
+// addLocalPort populates the port on the resource side of the activity
+func (l *LogEntry) addLocalPort(p *guardduty.LocalPortDetails) {
+	if p == nil {
+		return
+	}
+	l.LocalPort = aws.Int64Value(p.Port)
+	l.LocalPortName = aws.StringValue(p.PortName)
+	l.Port = aws.Int64Value(p.Port)
+	l.PortName = aws.StringValue(p.PortName)
+}
+
+// addLocalIp overrides the instance IP if the finding says which address was involved
+func (l *LogEntry) addLocalIp(i *guardduty.LocalIpDetails) {
+	if i == nil {
+		return
+	}
+	if ip := firstIp(i.IpAddressV4, i.IpAddressV6); ip != "" {
+		l.LocalIp = ip
+	}
+}
+
+// addRemotePort populates the port on the other side of the activity
+func (l *LogEntry) addRemotePort(p *guardduty.RemotePortDetails) {
+	if p == nil {
+		return
+	}
+	l.RemotePort = aws.Int64Value(p.Port)
+	l.RemotePortName = aws.StringValue(p.PortName)
+}
+
+// firstIp returns the first of the addresses that is set, normalized
+func firstIp(ips ...*string) string {
+	for _, ip := range ips {
+		if s, _ := ipaddr.Normalize(aws.StringValue(ip)); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// setDirection fills in the source and destination from the local and remote sides. Inbound means the remote side
+// started it.
+func (l *LogEntry) setDirection(inbound bool) {
+	if inbound {
+		l.SrcIp, l.SrcPort, l.SrcPortName = l.RemoteIp, l.RemotePort, l.RemotePortName
+		l.DestIp, l.DestPort, l.DestPortName = l.LocalIp, l.LocalPort, l.LocalPortName
+		l.tagIpVersions()
+		return
+	}
+	l.SrcIp, l.SrcPort, l.SrcPortName = l.LocalIp, l.LocalPort, l.LocalPortName
+	l.DestIp, l.DestPort, l.DestPortName = l.RemoteIp, l.RemotePort, l.RemotePortName
+	l.tagIpVersions()
+}
+
+// tagIpVersions records if the source and destination are IPv4 or IPv6
+func (l *LogEntry) tagIpVersions() {
+	_, l.SrcIpVersion = ipaddr.Normalize(l.SrcIp)
+	_, l.DestIpVersion = ipaddr.Normalize(l.DestIp)
+}
+
+// inbound decides the direction of a connection, falling back to the resource role when GuardDuty reports
+// UNKNOWN: if the resource is the TARGET the remote side is the source.
+func (l *LogEntry) inbound() bool {
+	switch l.ConnectionDirection {
+	case "INBOUND":
+		return true
+	case "OUTBOUND":
+		return false
+	}
+	return l.ResourceRole != "ACTOR"
+}
+
+// addRemoteIp populates the remote IP and its geo/org details
+func (l *LogEntry) addRemoteIp(r *guardduty.RemoteIpDetails) {
+	if r == nil {
+		return
+	}
+	l.RemoteIp = firstIp(r.IpAddressV4, r.IpAddressV6)
+	if r.City != nil {
+		l.RemoteIpCity = aws.StringValue(r.City.CityName)
+	}
+	if r.Country != nil {
+		l.RemoteIpCountry = aws.StringValue(r.Country.CountryName)
+	}
+	if r.GeoLocation != nil {
+		l.RemoteIpLat = aws.Float64Value(r.GeoLocation.Lat)
+		l.RemoteIpLon = aws.Float64Value(r.GeoLocation.Lon)
+	}
+	if r.Organization != nil {
+		l.RemoteIpAsn = aws.StringValue(r.Organization.Asn)
+		l.RemoteIpIsp = aws.StringValue(r.Organization.Isp)
+		l.RemoteIpOrg = aws.StringValue(r.Organization.Org)
+	}
+	l.SrcIpCity, l.SrcIpCountry = l.RemoteIpCity, l.RemoteIpCountry
+	l.SrcIpLat, l.SrcIpLon = l.RemoteIpLat, l.RemoteIpLon
+	l.SrcIpAsn, l.SrcIpOrg, l.SrcIpIsp = l.RemoteIpAsn, l.RemoteIpOrg, l.RemoteIpIsp
+}
+
+// addKubernetesApiCall populates information about a suspicious call to the kubernetes API
+func (l *LogEntry) addKubernetesApiCall(a *guardduty.Action) {
+	if k := a.KubernetesApiCallAction; k != nil {
+		l.K8sVerb = aws.StringValue(k.Verb)
+		l.K8sRequestUri = aws.StringValue(k.RequestUri)
+		l.K8sResource = aws.StringValue(k.Resource)
+		l.K8sResourceName = aws.StringValue(k.ResourceName)
+		l.K8sSubresource = aws.StringValue(k.Subresource)
+		l.K8sNamespace = aws.StringValue(k.Namespace)
+		l.K8sStatusCode = aws.Int64Value(k.StatusCode)
+		l.K8sParameters = aws.StringValue(k.Parameters)
+		l.K8sSourceIps = aws.StringValueSlice(k.SourceIps)
+		l.UserAgent = aws.StringValue(k.UserAgent)
+		l.addRemoteIp(k.RemoteIpDetails)
+		l.setDirection(true)
+	}
+	if p := a.KubernetesPermissionCheckedDetails; p != nil {
+		l.K8sAllowed = p.Allowed
+		if l.K8sVerb == "" {
+			l.K8sVerb = aws.StringValue(p.Verb)
+			l.K8sResource = aws.StringValue(p.Resource)
+			l.K8sNamespace = aws.StringValue(p.Namespace)
+		}
+	}
+	if r := a.KubernetesRoleDetails; r != nil {
+		l.K8sRoleKind = aws.StringValue(r.Kind)
+		l.K8sRoleName = aws.StringValue(r.Name)
+	}
+	if b := a.KubernetesRoleBindingDetails; b != nil {
+		l.K8sRoleBinding = aws.StringValue(b.Name)
+		l.K8sRoleRefKind = aws.StringValue(b.RoleRefKind)
+		l.K8sRoleRefName = aws.StringValue(b.RoleRefName)
+	}
+}
+
+// addRdsLogin populates information about one user/application's login attempts to a database
+func (l *LogEntry) addRdsLogin(r *guardduty.RdsLoginAttemptAction, a *guardduty.LoginAttribute) {
+	l.addRemoteIp(r.RemoteIpDetails)
+	l.setDirection(true)
+	if a == nil {
+		return
+	}
+	l.RdsLoginUser = aws.StringValue(a.User)
+	l.RdsLoginApplication = aws.StringValue(a.Application)
+	l.RdsLoginFailed = aws.Int64Value(a.FailedLoginAttempts)
+	l.RdsLoginSucceeded = aws.Int64Value(a.SuccessfulLoginAttempts)
+}
+
+// addRuntime populates the process and context from a Runtime Monitoring finding
+func (l *LogEntry) addRuntime(r *guardduty.RuntimeDetails) {
+	if p := r.Process; p != nil {
+		l.ProcessName = aws.StringValue(p.Name)
+		l.ProcessPath = aws.StringValue(p.ExecutablePath)
+		l.ProcessSha256 = aws.StringValue(p.ExecutableSha256)
+		l.ProcessPid = aws.Int64Value(p.Pid)
+		l.ProcessUser = aws.StringValue(p.User)
+	}
+	if c := r.Context; c != nil {
+		l.RuntimeCommand = aws.StringValue(c.CommandLineExample)
+		l.RuntimeTool = aws.StringValue(c.ToolName)
+		l.RuntimeToolType = aws.StringValue(c.ToolCategory)
+		l.RuntimeFilePath = aws.StringValue(c.ThreatFilePath)
+	}
+}
+
+// addMalwareScan populates the scan and threats from a Malware Protection finding
+func (l *LogEntry) addMalwareScan(s *guardduty.Service) {
+	if e := s.EbsVolumeScanDetails; e != nil {
+		l.MalwareScanId = aws.StringValue(e.ScanId)
+		l.MalwareScanType = aws.StringValue(e.ScanType)
+		if e.ScanDetections != nil && e.ScanDetections.ThreatDetectedByName != nil {
+			for _, t := range e.ScanDetections.ThreatDetectedByName.ThreatNames {
+				if t != nil {
+					l.MalwareThreatNames = append(l.MalwareThreatNames, aws.StringValue(t.Name))
+				}
+			}
+		}
+	}
+	if m := s.MalwareScanDetails; m != nil {
+		for _, t := range m.Threats {
+			if t != nil {
+				l.MalwareThreatNames = append(l.MalwareThreatNames, aws.StringValue(t.Name))
+			}
+		}
+	}
+}
+
+// ErrInvalidFinding is wrapped by every FindingError, use errors.Is to check for it.
+var ErrInvalidFinding = errors.New("invalid guardduty finding")
+
+// FindingError is returned when a finding is missing something it can't be flattened without, for example a
+// PORT_PROBE action with no portProbeAction.
+type FindingError struct {
+	Id     string
+	Reason string
+}
+
+func (e *FindingError) Error() string {
+	return fmt.Sprintf("%v %q: %s", ErrInvalidFinding, e.Id, e.Reason)
+}
+
+func (e *FindingError) Unwrap() error {
+	return ErrInvalidFinding
 }
 
 // NewLogs manipulates a guardduty.Finding into flat structs, and if there are multiple events in the finding
-// returns multiple LogEntry records to denormalize the events into discrete logs.
+// returns multiple LogEntry records to denormalize the events into discrete logs. Findings without an action
+// (Runtime Monitoring, Malware Protection) or with an action type we don't know about still produce one record.
+// Missing optional details are left empty, but a *FindingError is returned if the finding has no id, or an
+// action type without the matching action details.
 func NewLogs(finding *guardduty.Finding) (logs []LogEntry, err error) {
-	switch aws.StringValue(finding.Service.Action.ActionType) {
+	if finding == nil {
+		return nil, &FindingError{Reason: "finding is nil"}
+	}
+	id := aws.StringValue(finding.Id)
+	if id == "" {
+		return nil, &FindingError{Reason: "finding has no id"}
+	}
+	base := LogEntry{}
+	base.addCommon(finding)
+	base.addResource(finding.Resource)
+	action := &guardduty.Action{}
+	if finding.Service != nil {
+		base.addCommonService(finding.Service)
+		if finding.Service.RuntimeDetails != nil {
+			base.addRuntime(finding.Service.RuntimeDetails)
+		}
+		base.addMalwareScan(finding.Service)
+		if finding.Service.Action != nil {
+			action = finding.Service.Action
+		}
+	}
+	missing := func(what string) error {
+		return &FindingError{Id: id, Reason: fmt.Sprintf("%s action has no %s", aws.StringValue(action.ActionType), what)}
+	}
+
+	switch aws.StringValue(action.ActionType) {
 	// if this is a port-probe, it can have multiple events in a single record, so we add a new log for each.
 	case "PORT_PROBE":
-		for _, probe := range finding.Service.Action.PortProbeAction.PortProbeDetails {
-			l := LogEntry{}
-			l.addCommon(finding)
-			l.addInstance(finding.Resource.InstanceDetails)
-			l.addCommonService(finding.Service)
-			l.addPortProbe(finding.Service.Action.PortProbeAction, probe)
+		if action.PortProbeAction == nil {
+			return nil, missing("portProbeAction")
+		}
+		for _, probe := range action.PortProbeAction.PortProbeDetails {
+			l := base
+			l.addPortProbe(action.PortProbeAction, probe)
 			logs = append(logs, l)
 		}
-	case "NETWORK_CONNECTION":
-		l := LogEntry{}
-		l.addCommon(finding)
-		if finding.Resource != nil && finding.Resource.InstanceDetails != nil {
-			l.addInstance(finding.Resource.InstanceDetails)
+		if len(logs) == 0 {
+			l := base
+			l.addPortProbe(action.PortProbeAction, nil)
+			logs = append(logs, l)
 		}
-		if finding.Service != nil {
-			l.addCommonService(finding.Service)
+	case "NETWORK_CONNECTION":
+		if action.NetworkConnectionAction == nil {
+			return nil, missing("networkConnectionAction")
 		}
-		l.addConnection(finding.Service.Action.NetworkConnectionAction)
+		l := base
+		l.addConnection(action.NetworkConnectionAction)
 		logs = append(logs, l)
 	case "DNS_REQUEST":
-		l := LogEntry{}
-		l.addCommon(finding)
-		if finding.Resource != nil && finding.Resource.InstanceDetails != nil {
-			l.addInstance(finding.Resource.InstanceDetails)
+		if action.DnsRequestAction == nil {
+			return nil, missing("dnsRequestAction")
 		}
-		if finding.Service != nil {
-			l.addCommonService(finding.Service)
-		}
-		l.addDns(finding.Service.Action.DnsRequestAction)
+		l := base
+		l.addDns(action.DnsRequestAction)
 		logs = append(logs, l)
 	case "AWS_API_CALL":
-		l := LogEntry{}
-		l.addCommon(finding)
-		if finding.Service != nil {
-			l.addCommonService(finding.Service)
+		if action.AwsApiCallAction == nil {
+			return nil, missing("awsApiCallAction")
+		}
+		l := base
+		l.addApiCall(action.AwsApiCallAction)
+		logs = append(logs, l)
+	case "KUBERNETES_API_CALL":
+		if action.KubernetesApiCallAction == nil {
+			return nil, missing("kubernetesApiCallAction")
 		}
-		l.addApiCall(finding.Service.Action.AwsApiCallAction)
+		fallthrough
+	case "KUBERNETES_PERMISSION_CHECKED", "KUBERNETES_ROLE", "KUBERNETES_ROLE_BINDING":
+		l := base
+		l.addKubernetesApiCall(action)
 		logs = append(logs, l)
+	// like port probes, each user/application pair is a separate log
+	case "RDS_LOGIN_ATTEMPT":
+		if action.RdsLoginAttemptAction == nil {
+			return nil, missing("rdsLoginAttemptAction")
+		}
+		for _, attr := range action.RdsLoginAttemptAction.LoginAttributes {
+			l := base
+			l.addRdsLogin(action.RdsLoginAttemptAction, attr)
+			logs = append(logs, l)
+		}
+		if len(logs) == 0 {
+			l := base
+			l.addRdsLogin(action.RdsLoginAttemptAction, nil)
+			logs = append(logs, l)
+		}
+	default:
+		logs = append(logs, base)
 	}
 	return
 }
 
+// ParseEvent decodes the detail of a GuardDuty EventBridge event into a guardduty.Finding
 func ParseEvent(ev *json.RawMessage) (*guardduty.Finding, error) {
+	if ev == nil {
+		return nil, &FindingError{Reason: "event has no detail"}
+	}
 	// can't directly cast to guardduty.Finding type, have to roundtrip via marshalling :(
 	j, _ := ev.MarshalJSON()
 	finding := &guardduty.Finding{}
@@ -302,5 +798,17 @@ func ParseEvent(ev *json.RawMessage) (*guardduty.Finding, error) {
 	if err != nil {
 		return nil, err
 	}
+	// EventBridge sends additionalInfo as an object, GetFindings as {"type": ..., "value": "<json>"}. The SDK type only
+	// has the latter, so keep the raw object as the value.
+	raw := struct {
+		Service struct {
+			AdditionalInfo json.RawMessage `json:"additionalInfo"`
+		} `json:"service"`
+	}{}
+	if json.Unmarshal(j, &raw) == nil && finding.Service != nil && finding.Service.AdditionalInfo != nil &&
+		len(raw.Service.AdditionalInfo) > 0 && raw.Service.AdditionalInfo[0] == '{' &&
+		aws.StringValue(finding.Service.AdditionalInfo.Value) == "" {
+		finding.Service.AdditionalInfo.Value = aws.String(string(raw.Service.AdditionalInfo))
+	}
 	return finding, nil
 }
@@ -0,0 +1,44 @@
+package guarddutylogs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/blockpane/logsuck/internal/ndjson"
+	"io"
+	"log"
+)
+
+// DecodeExport reads a GuardDuty findings export, JSON lines with one finding per line and usually gzipped, and
+// calls emit for each finding. Findings are decoded one at a time so large objects never need to fit in memory.
+func DecodeExport(r io.Reader, emit func(*guardduty.Finding) error) (count int, err error) {
+	return ndjson.Decode(r, 0, func(raw json.RawMessage) error {
+		finding, err := ParseEvent(&raw)
+		if err != nil {
+			return err
+		}
+		return emit(finding)
+	})
+}
+
+// HandleS3Event processes S3 ObjectCreated notifications from the bucket GuardDuty exports findings to, and calls
+// emit for each log entry. The exports are encrypted with KMS, S3 decrypts them as long as the caller has
+// kms:Decrypt on the key. emit is called with the log entries for each finding, findings that can't be flattened are
+// logged and skipped.
+func HandleS3Event(ctx context.Context, svc s3iface.S3API, event events.S3Event, emit func([]LogEntry) error) error {
+	return ndjson.HandleS3Event(ctx, svc, event, "findings", func(key string, body io.Reader) (int, error) {
+		return DecodeExport(body, func(f *guardduty.Finding) error {
+			logs, err := NewLogs(f)
+			if errors.Is(err, ErrInvalidFinding) {
+				log.Println("skipping finding:", err)
+				return nil
+			} else if err != nil {
+				return err
+			}
+			return emit(logs)
+		})
+	})
+}
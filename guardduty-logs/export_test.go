@@ -0,0 +1,84 @@
+package guarddutylogs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"testing"
+)
+
+// exportObject builds a gzipped JSON lines export from the rawEvents fixtures, plus a finding that can't be flattened.
+func exportObject(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	for _, rawEvent := range rawEvents {
+		cwEvent := &events.CloudWatchEvent{}
+		if err := json.Unmarshal([]byte(rawEvent), cwEvent); err != nil {
+			t.Fatal(err)
+		}
+		gz.Write(cwEvent.Detail)
+		gz.Write([]byte("\n"))
+	}
+	gz.Write([]byte(`{"id":"broken","service":{"action":{"actionType":"PORT_PROBE"}}}` + "\n"))
+	gz.Close()
+	return buf.Bytes()
+}
+
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(f.objects[aws.StringValue(in.Key)]))}, nil
+}
+
+func TestHandleS3Event(t *testing.T) {
+	key := "AWSLogs/112233445566/GuardDuty/us-east-1/2023/05/01/abcd.jsonl.gz"
+	svc := &fakeS3{objects: map[string][]byte{key: exportObject(t)}}
+	event := events.S3Event{Records: []events.S3EventRecord{
+		{EventName: "ObjectCreated:Put", S3: events.S3Entity{Bucket: events.S3Bucket{Name: "findings"}, Object: events.S3Object{Key: key}}},
+		{EventName: "ObjectRemoved:Delete", S3: events.S3Entity{Bucket: events.S3Bucket{Name: "findings"}, Object: events.S3Object{Key: "missing"}}},
+	}}
+
+	expected := 0
+	for _, rawEvent := range rawEvents {
+		cwEvent := &events.CloudWatchEvent{}
+		json.Unmarshal([]byte(rawEvent), cwEvent)
+		gd, _ := ParseEvent(&cwEvent.Detail)
+		logs, _ := NewLogs(gd)
+		expected += len(logs)
+	}
+
+	logs := make([]LogEntry, 0)
+	err := HandleS3Event(context.Background(), svc, event, func(l []LogEntry) error {
+		logs = append(logs, l...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != expected {
+		t.Errorf("expected %d log entries, got %d", expected, len(logs))
+	}
+	if logs[0].Id != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+		t.Errorf("unexpected first entry %+v", logs[0])
+	}
+}
+
+func TestDecodeExportPlain(t *testing.T) {
+	count, err := DecodeExport(bytes.NewReader([]byte(`{"id":"a"}`+"\n"+`{"id":"b"}`)), func(f *guardduty.Finding) error {
+		return nil
+	})
+	if err != nil || count != 2 {
+		t.Errorf("expected 2 findings, got %d: %v", count, err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+
+package guarddutylogs
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"testing"
+)
+
+// FuzzNewLogs checks that no detail, however broken, can make ParseEvent or NewLogs panic.
+func FuzzNewLogs(f *testing.F) {
+	for _, rawEvent := range rawEvents {
+		cwEvent := &events.CloudWatchEvent{}
+		if err := json.Unmarshal([]byte(rawEvent), cwEvent); err != nil {
+			f.Fatal(err)
+		}
+		f.Add([]byte(cwEvent.Detail))
+	}
+	// partial findings that used to panic
+	f.Add([]byte(`{"id":"x","service":{"action":{"actionType":"PORT_PROBE"}}}`))
+	f.Add([]byte(`{"id":"x","service":{"action":{"actionType":"PORT_PROBE","portProbeAction":{"portProbeDetails":[{},null]}}}}`))
+	f.Add([]byte(`{"id":"x","service":{"action":{"actionType":"AWS_API_CALL","awsApiCallAction":{"remoteIpDetails":{}}}}}`))
+	f.Add([]byte(`{"id":"x","resource":{"instanceDetails":{"networkInterfaces":[null],"tags":[null]}}}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, detail []byte) {
+		raw := json.RawMessage(detail)
+		finding, err := ParseEvent(&raw)
+		if err != nil {
+			return
+		}
+		logs, err := NewLogs(finding)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidFinding) {
+				t.Errorf("expected a FindingError, got %v", err)
+			}
+			return
+		}
+		if len(logs) == 0 {
+			t.Error("a valid finding should produce at least one log")
+		}
+	})
+}
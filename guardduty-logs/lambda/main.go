@@ -3,14 +3,63 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
 	guarddutylogs "github.com/blockpane/logsuck/guardduty-logs"
+	"log"
+	"os"
+	"strings"
+	"time"
 )
 
+var (
+	dedup    *guarddutylogs.Deduper    // nil unless DEDUP_TABLE is set
+	suppress *guarddutylogs.Suppressor // nil unless RULES_FILE is set
+)
+
+// MODE selects how findings are collected: event (the default) is triggered by the EventBridge rule, poll runs on
+// a schedule and fetches findings updated since the checkpoint, and backfill is run once to fetch every active
+// finding and set the checkpoint for poll mode. s3 is triggered by notifications from the findings export bucket,
+// and sqs by a queue the EventBridge rule delivers to.
+//
+// If DEDUP_TABLE names a DynamoDB table (partition key "id", a string) repeated updates to a finding only print the
+// details that are new, or a compact "finding updated" entry with the count delta.
+//
+// If RULES_FILE is the path to a JSON list of suppression rules, matching log entries are dropped, tagged as
+// suppressed, or tagged and the finding archived in GuardDuty.
 func main() {
-	lambda.Start(HandleRequest)
+	if table := os.Getenv("DEDUP_TABLE"); table != "" {
+		sess, err := session.NewSession()
+		if err != nil {
+			log.Fatal(err)
+		}
+		dedup = guarddutylogs.NewDeduper(guarddutylogs.NewDynamoStore(dynamodb.New(sess), table))
+	}
+	if path := os.Getenv("RULES_FILE"); path != "" {
+		var err error
+		if suppress, err = loadRules(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+	switch os.Getenv("MODE") {
+	case "poll":
+		lambda.Start(HandlePoll)
+	case "backfill":
+		lambda.Start(HandleBackfill)
+	case "s3":
+		lambda.Start(HandleExport)
+	case "sqs":
+		lambda.Start(HandleSQS)
+	default:
+		lambda.Start(HandleRequest)
+	}
 }
 
 func HandleRequest(ctx context.Context, event events.CloudWatchEvent) (msg string, err error) {
@@ -22,10 +71,174 @@ func HandleRequest(ctx context.Context, event events.CloudWatchEvent) (msg strin
 	if err != nil {
 		return "couldn't build logs slice", err
 	}
-	for _, log := range logs {
+	if err = printLogs(logs); err != nil {
+		return "couldn't check for duplicates", err
+	}
+	return "", nil
+
+}
+
+// HandleExport prints the findings in objects written by the GuardDuty S3 export.
+func HandleExport(ctx context.Context, event events.S3Event) error {
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	return guarddutylogs.HandleS3Event(ctx, s3.New(sess), event, printLogs)
+}
+
+// HandleSQS prints the findings in a batch of SQS messages, and reports the messages that failed so only they are retried.
+func HandleSQS(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	return guarddutylogs.HandleSQSEvent(ctx, event, printLogs), nil
+}
+
+// HandlePoll prints findings updated since the last run.
+func HandlePoll() error {
+	return poll(func(cp *guarddutylogs.Checkpoint) (*guardduty.FindingCriteria, time.Time, error) {
+		last, err := cp.Load()
+		if err != nil {
+			return nil, last, err
+		}
+		if last.IsZero() {
+			log.Println("warning: no checkpoint found, starting from now. Use MODE=backfill to fetch existing findings.")
+			last = time.Now().UTC()
+		}
+		log.Println("fetching findings updated since", last.Format(time.RFC3339))
+		return guarddutylogs.UpdatedSince(last), last, nil
+	})
+}
+
+// HandleBackfill prints every active finding, polling carries on from when the backfill started.
+func HandleBackfill() error {
+	return poll(func(cp *guarddutylogs.Checkpoint) (*guardduty.FindingCriteria, time.Time, error) {
+		log.Println("backfilling all active findings")
+		return guarddutylogs.Active(), time.Now().UTC(), nil
+	})
+}
+
+// poll runs the criteria against each detector in every target account and region. Each target has its own
+// checkpoint, which is saved as the newest updatedAt seen, or the time the criteria start from if nothing newer was
+// found, even if there was an error part way through. That way each run carries on from where the last one stopped.
+func poll(criteria func(*guarddutylogs.Checkpoint) (*guardduty.FindingCriteria, time.Time, error)) error {
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	param := os.Getenv("SSM_TIMESTAMP")
+	if param == "" {
+		param = "/guardduty/timestamp"
+	}
+	org, err := guarddutylogs.NewOrganization(sess, splitEnv("REGIONS"), os.Getenv("ROLE_NAME"), splitEnv("ACCOUNTS"))
+	if err != nil {
+		return err
+	}
+	targets, err := org.Targets()
+	if err != nil {
+		return err
+	}
+	store := ssm.New(sess)
+	var failed error
+	for _, t := range targets {
+		cp := guarddutylogs.NewCheckpoint(store, param+"/"+t.Account+"/"+t.Region)
+		if err = pollTarget(t, cp, criteria); err != nil {
+			log.Printf("error polling %s: %v\n", t, err)
+			failed = err
+		}
+	}
+	return failed
+}
+
+func pollTarget(t guarddutylogs.Target, cp *guarddutylogs.Checkpoint, criteria func(*guarddutylogs.Checkpoint) (*guardduty.FindingCriteria, time.Time, error)) error {
+	fc, newest, err := criteria(cp)
+	if err != nil {
+		return err
+	}
+	detectors, err := t.Poller.Detectors()
+	if err != nil {
+		return err
+	}
+	if len(detectors) == 0 {
+		return errors.New("no guardduty detectors found")
+	}
+	for _, detector := range detectors {
+		last, err := t.Poller.Collect(detector, fc, func(f *guardduty.Finding) error {
+			t.Stamp(f)
+			return printFinding(f)
+		})
+		if last.After(newest) {
+			newest = last
+		}
+		if err != nil {
+			saveCheckpoint(cp, newest)
+			return err
+		}
+	}
+	saveCheckpoint(cp, newest)
+	return nil
+}
+
+// splitEnv reads a comma separated list from an env var
+func splitEnv(name string) (list []string) {
+	for _, s := range strings.Split(os.Getenv(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return
+}
+
+// printFinding logs a finding, findings that can't be flattened are skipped so they don't block the rest.
+func printFinding(f *guardduty.Finding) error {
+	logs, err := guarddutylogs.NewLogs(f)
+	if err != nil {
+		log.Println("skipping finding:", err)
+		return nil
+	}
+	return printLogs(logs)
+}
+
+// loadRules reads the suppression rules. Archive rules use the detector in each finding's account and region, this
+// account's if it is the GuardDuty administrator, otherwise by assuming ROLE_NAME in the finding's account.
+func loadRules(path string) (*guarddutylogs.Suppressor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := guarddutylogs.ReadRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	org, err := guarddutylogs.NewOrganization(sess, splitEnv("REGIONS"), os.Getenv("ROLE_NAME"), splitEnv("ACCOUNTS"))
+	if err != nil {
+		return nil, err
+	}
+	return guarddutylogs.NewSuppressor(rules, org)
+}
+
+// printLogs prints the log entries for a finding, minus any the Deduper has already seen or a suppression rule
+// dropped. Deduplicating first means a re-delivered update doesn't fire the rules again.
+func printLogs(logs []guarddutylogs.LogEntry) error {
+	fresh, err := dedup.Filter(logs)
+	if err != nil {
+		return err
+	}
+	for _, log := range suppress.Apply(logs, fresh) {
 		j, _ := json.Marshal(log)
 		fmt.Println(string(j))
 	}
-	return "", nil
+	return nil
+}
 
+func saveCheckpoint(cp *guarddutylogs.Checkpoint, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if err := cp.Save(t); err != nil {
+		log.Println("could not save checkpoint:", err)
+	}
 }
@@ -0,0 +1,182 @@
+package guarddutylogs
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/guardduty/guarddutyiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"log"
+	"sort"
+)
+
+// Target is a single account and region to poll for findings.
+type Target struct {
+	Account string
+	Region  string
+	Poller  *Poller
+}
+
+func (t Target) String() string {
+	return t.Account + "/" + t.Region
+}
+
+// Stamp fills in the account and region of a finding if GuardDuty left them empty, so every log line has both.
+func (t Target) Stamp(f *guardduty.Finding) {
+	if aws.StringValue(f.AccountId) == "" {
+		f.AccountId = aws.String(t.Account)
+	}
+	if aws.StringValue(f.Region) == "" {
+		f.Region = aws.String(t.Region)
+	}
+}
+
+// Organization works out which accounts and regions need polling. In each region the local detector is polled,
+// and if it is a GuardDuty administrator that already covers every enabled member. Members that aren't enabled,
+// and any extra Accounts, are polled directly by assuming RoleName in that account.
+type Organization struct {
+	Self     string
+	Regions  []string
+	RoleName string
+	Accounts []string
+
+	// Client returns a GuardDuty client for a region, assuming RoleName in account unless it is Self.
+	Client func(account string, region string) guarddutyiface.GuardDutyAPI
+
+	pollers   map[string]*Poller
+	detectors map[string][]string
+}
+
+// NewOrganization looks up the current account and returns an Organization using sess for credentials.
+func NewOrganization(sess *session.Session, regions []string, roleName string, accounts []string) (*Organization, error) {
+	id, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+	o := &Organization{
+		Self:     aws.StringValue(id.Account),
+		Regions:  regions,
+		RoleName: roleName,
+		Accounts: accounts,
+	}
+	if len(o.Regions) == 0 {
+		o.Regions = []string{aws.StringValue(sess.Config.Region)}
+	}
+	o.Client = func(account string, region string) guarddutyiface.GuardDutyAPI {
+		cfg := aws.NewConfig().WithRegion(region)
+		if account != o.Self {
+			cfg.WithCredentials(stscreds.NewCredentials(sess, fmt.Sprintf("arn:aws:iam::%s:role/%s", account, o.RoleName)))
+		}
+		return guardduty.New(sess, cfg)
+	}
+	return o, nil
+}
+
+// Targets returns every account and region to poll. Accounts can only be polled by assuming RoleName, so it is an
+// error to have Accounts without it.
+func (o *Organization) Targets() (targets []Target, err error) {
+	if len(o.Accounts) > 0 && o.RoleName == "" {
+		return nil, fmt.Errorf("polling accounts %v needs a role name to assume in them", o.Accounts)
+	}
+	for _, region := range o.Regions {
+		home := Target{Account: o.Self, Region: region, Poller: NewPoller(o.Client(o.Self, region))}
+		targets = append(targets, home)
+		if o.RoleName == "" {
+			continue
+		}
+
+		covered := map[string]bool{o.Self: true}
+		direct := make(map[string]bool)
+		for _, a := range o.Accounts {
+			direct[a] = true
+		}
+		detectors, err := home.Poller.Detectors()
+		if err != nil {
+			return nil, err
+		}
+		for _, detector := range detectors {
+			members, err := home.Poller.Members(detector)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range members {
+				if m == nil {
+					continue
+				}
+				if aws.StringValue(m.RelationshipStatus) == "Enabled" {
+					covered[aws.StringValue(m.AccountId)] = true
+				} else {
+					direct[aws.StringValue(m.AccountId)] = true
+				}
+			}
+		}
+
+		accounts := make([]string, 0, len(direct))
+		for a := range direct {
+			if !covered[a] && a != "" {
+				accounts = append(accounts, a)
+			}
+		}
+		sort.Strings(accounts)
+		for _, a := range accounts {
+			log.Printf("polling %s/%s directly with role %s\n", a, region, o.RoleName)
+			targets = append(targets, Target{Account: a, Region: region, Poller: NewPoller(o.Client(a, region))})
+		}
+	}
+	return
+}
+
+// Archive archives findings from account and region. Only a GuardDuty administrator can archive its members'
+// findings, so if the detector is one of this account's in that region it is used directly, otherwise RoleName is
+// assumed in the finding's account.
+func (o *Organization) Archive(account string, region string, detector string, ids []string, feedback string) error {
+	if region == "" {
+		region = o.Regions[0]
+	}
+	if account == "" {
+		account = o.Self
+	}
+	if account != o.Self {
+		own, err := o.ownDetector(region, detector)
+		if err != nil {
+			return err
+		}
+		if own {
+			account = o.Self
+		} else if o.RoleName == "" {
+			return fmt.Errorf("detector %s is in account %s, archiving it needs ROLE_NAME", detector, account)
+		}
+	}
+	return o.poller(account, region).Archive(detector, ids, feedback)
+}
+
+// ownDetector is true if detector is one of this account's in region.
+func (o *Organization) ownDetector(region string, detector string) (bool, error) {
+	detectors, ok := o.detectors[region]
+	if !ok {
+		var err error
+		if detectors, err = o.poller(o.Self, region).Detectors(); err != nil {
+			return false, err
+		}
+		if o.detectors == nil {
+			o.detectors = make(map[string][]string)
+		}
+		o.detectors[region] = detectors
+	}
+	return contains(detectors, detector), nil
+}
+
+// poller returns a Poller for account and region, reusing the client from earlier calls.
+func (o *Organization) poller(account string, region string) *Poller {
+	key := account + "/" + region
+	if p, ok := o.pollers[key]; ok {
+		return p
+	}
+	if o.pollers == nil {
+		o.pollers = make(map[string]*Poller)
+	}
+	o.pollers[key] = NewPoller(o.Client(account, region))
+	return o.pollers[key]
+}
@@ -0,0 +1,111 @@
+package guarddutylogs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/guardduty/guarddutyiface"
+	"time"
+)
+
+// getFindingsMax is the most finding ids GetFindings will accept, and the largest ListFindings page.
+const getFindingsMax = 50
+
+// Poller fetches findings with the GuardDuty API, for picking up anything the EventBridge rule missed.
+type Poller struct {
+	GuardDuty guarddutyiface.GuardDutyAPI
+}
+
+// NewPoller returns a Poller using the client.
+func NewPoller(svc guarddutyiface.GuardDutyAPI) *Poller {
+	return &Poller{GuardDuty: svc}
+}
+
+// Detectors lists the detector ids in the client's account and region.
+func (p *Poller) Detectors() (ids []string, err error) {
+	err = p.GuardDuty.ListDetectorsPages(&guardduty.ListDetectorsInput{}, func(out *guardduty.ListDetectorsOutput, last bool) bool {
+		ids = append(ids, aws.StringValueSlice(out.DetectorIds)...)
+		return true
+	})
+	return
+}
+
+// Members lists every member account of a detector, whatever its relationship status.
+func (p *Poller) Members(detector string) (members []*guardduty.Member, err error) {
+	input := &guardduty.ListMembersInput{
+		DetectorId:     aws.String(detector),
+		OnlyAssociated: aws.String("false"),
+	}
+	err = p.GuardDuty.ListMembersPages(input, func(out *guardduty.ListMembersOutput, last bool) bool {
+		members = append(members, out.Members...)
+		return true
+	})
+	return
+}
+
+// UpdatedSince returns criteria matching findings updated at or after t. The boundary is inclusive, so the last
+// finding from the previous run can be repeated, but nothing updated in the same millisecond is lost.
+func UpdatedSince(t time.Time) *guardduty.FindingCriteria {
+	return &guardduty.FindingCriteria{
+		Criterion: map[string]*guardduty.Condition{
+			"updatedAt": {GreaterThanOrEqual: aws.Int64(t.UnixNano() / int64(time.Millisecond))},
+		},
+	}
+}
+
+// Active returns criteria matching every finding that hasn't been archived, for a one-time backfill.
+func Active() *guardduty.FindingCriteria {
+	return &guardduty.FindingCriteria{
+		Criterion: map[string]*guardduty.Condition{
+			"service.archived": {Equals: aws.StringSlice([]string{"false"})},
+		},
+	}
+}
+
+// Collect pages through the findings for a detector that match criteria, oldest update first, and calls emit with
+// each one. It returns the newest updatedAt seen, which is still valid when an error is also returned, or the zero
+// time if nothing was found.
+func (p *Poller) Collect(detector string, criteria *guardduty.FindingCriteria, emit func(*guardduty.Finding) error) (last time.Time, err error) {
+	input := &guardduty.ListFindingsInput{
+		DetectorId:      aws.String(detector),
+		FindingCriteria: criteria,
+		MaxResults:      aws.Int64(getFindingsMax),
+		SortCriteria: &guardduty.SortCriteria{
+			AttributeName: aws.String("updatedAt"),
+			OrderBy:       aws.String(guardduty.OrderByAsc),
+		},
+	}
+	var emitErr error
+	err = p.GuardDuty.ListFindingsPages(input, func(out *guardduty.ListFindingsOutput, lastPage bool) bool {
+		if len(out.FindingIds) == 0 {
+			return true
+		}
+		var findings *guardduty.GetFindingsOutput
+		findings, emitErr = p.GuardDuty.GetFindings(&guardduty.GetFindingsInput{
+			DetectorId: aws.String(detector),
+			FindingIds: out.FindingIds,
+			SortCriteria: &guardduty.SortCriteria{
+				AttributeName: aws.String("updatedAt"),
+				OrderBy:       aws.String(guardduty.OrderByAsc),
+			},
+		})
+		if emitErr != nil {
+			return false
+		}
+		for _, f := range findings.Findings {
+			if f == nil {
+				continue
+			}
+			if emitErr = emit(f); emitErr != nil {
+				return false
+			}
+			if updated, e := time.Parse(time.RFC3339, aws.StringValue(f.UpdatedAt)); e == nil && updated.After(last) {
+				last = updated
+			}
+		}
+		return true
+	})
+	if emitErr != nil {
+		err = emitErr
+	}
+	return
+}
@@ -0,0 +1,187 @@
+package guarddutylogs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/aws/aws-sdk-go/service/guardduty/guarddutyiface"
+	"testing"
+	"time"
+)
+
+// fakeGuardDuty pages through findings ids in pages of size, GetFindings fails for any id in fail.
+type fakeGuardDuty struct {
+	guarddutyiface.GuardDutyAPI
+	findings map[string]*guardduty.Finding
+	ids      []string
+	size     int
+	fail     string
+	criteria *guardduty.FindingCriteria
+	archived []string
+}
+
+func newFakeGuardDuty(n int, size int) *fakeGuardDuty {
+	f := &fakeGuardDuty{findings: make(map[string]*guardduty.Finding), size: size}
+	start := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("finding-%d", i)
+		f.ids = append(f.ids, id)
+		f.findings[id] = &guardduty.Finding{
+			Id:        aws.String(id),
+			UpdatedAt: aws.String(start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)),
+		}
+	}
+	return f
+}
+
+func (f *fakeGuardDuty) ListDetectorsPages(in *guardduty.ListDetectorsInput, fn func(*guardduty.ListDetectorsOutput, bool) bool) error {
+	fn(&guardduty.ListDetectorsOutput{DetectorIds: aws.StringSlice([]string{"d1"})}, true)
+	return nil
+}
+
+func (f *fakeGuardDuty) ListFindingsPages(in *guardduty.ListFindingsInput, fn func(*guardduty.ListFindingsOutput, bool) bool) error {
+	f.criteria = in.FindingCriteria
+	for i := 0; i < len(f.ids); i += f.size {
+		end := i + f.size
+		if end > len(f.ids) {
+			end = len(f.ids)
+		}
+		if !fn(&guardduty.ListFindingsOutput{FindingIds: aws.StringSlice(f.ids[i:end])}, end == len(f.ids)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeGuardDuty) GetFindings(in *guardduty.GetFindingsInput) (*guardduty.GetFindingsOutput, error) {
+	if len(in.FindingIds) > getFindingsMax {
+		return nil, errors.New("too many finding ids")
+	}
+	out := &guardduty.GetFindingsOutput{}
+	for _, id := range aws.StringValueSlice(in.FindingIds) {
+		if id == f.fail {
+			return nil, errors.New("throttled")
+		}
+		out.Findings = append(out.Findings, f.findings[id])
+	}
+	return out, nil
+}
+
+func TestPollerCollect(t *testing.T) {
+	svc := newFakeGuardDuty(120, getFindingsMax)
+	p := NewPoller(svc)
+	detectors, err := p.Detectors()
+	if err != nil || len(detectors) != 1 {
+		t.Fatalf("expected one detector, got %v %v", detectors, err)
+	}
+	since := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	count := 0
+	last, err := p.Collect(detectors[0], UpdatedSince(since), func(f *guardduty.Finding) error {
+		count += 1
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 120 {
+		t.Errorf("expected 120 findings, got %d", count)
+	}
+	if !last.Equal(since.Add(119 * time.Minute)) {
+		t.Errorf("unexpected checkpoint %v", last)
+	}
+	if aws.Int64Value(svc.criteria.Criterion["updatedAt"].GreaterThanOrEqual) != since.Unix()*1000 {
+		t.Error("expected the updatedAt criterion to be in milliseconds")
+	}
+
+	// an error part way through still returns the newest finding that was emitted
+	svc.fail = "finding-60"
+	count = 0
+	last, err = p.Collect(detectors[0], Active(), func(f *guardduty.Finding) error {
+		count += 1
+		return nil
+	})
+	if err == nil || count != 50 || !last.Equal(since.Add(49*time.Minute)) {
+		t.Errorf("expected an error after 50 findings, got %v after %d, checkpoint %v", err, count, last)
+	}
+}
+
+func (f *fakeGuardDuty) ListMembersPages(in *guardduty.ListMembersInput, fn func(*guardduty.ListMembersOutput, bool) bool) error {
+	fn(&guardduty.ListMembersOutput{Members: []*guardduty.Member{
+		{AccountId: aws.String("222222222222"), RelationshipStatus: aws.String("Enabled")},
+		{AccountId: aws.String("333333333333"), RelationshipStatus: aws.String("Removed")},
+		nil,
+	}}, true)
+	return nil
+}
+
+func TestOrganizationTargets(t *testing.T) {
+	o := &Organization{
+		Self:     "111111111111",
+		Regions:  []string{"us-east-1", "eu-west-1"},
+		RoleName: "guardduty-logs",
+		Accounts: []string{"222222222222", "444444444444"},
+		Client: func(account string, region string) guarddutyiface.GuardDutyAPI {
+			return newFakeGuardDuty(0, getFindingsMax)
+		},
+	}
+	targets, err := o.Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0)
+	for _, target := range targets {
+		got = append(got, target.String())
+	}
+	// 222222222222 is an enabled member so the administrator already sees its findings
+	expected := []string{
+		"111111111111/us-east-1", "333333333333/us-east-1", "444444444444/us-east-1",
+		"111111111111/eu-west-1", "333333333333/eu-west-1", "444444444444/eu-west-1",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("expected targets %v, got %v", expected, got)
+	}
+
+	o.RoleName = ""
+	if _, err = o.Targets(); err == nil {
+		t.Error("expected an error for accounts without a role name")
+	}
+
+	f := &guardduty.Finding{Region: aws.String("us-west-2")}
+	targets[1].Stamp(f)
+	if aws.StringValue(f.AccountId) != "333333333333" || aws.StringValue(f.Region) != "us-west-2" {
+		t.Errorf("unexpected stamp %s %s", aws.StringValue(f.AccountId), aws.StringValue(f.Region))
+	}
+}
+
+func (f *fakeGuardDuty) ArchiveFindings(in *guardduty.ArchiveFindingsInput) (*guardduty.ArchiveFindingsOutput, error) {
+	f.archived = append(f.archived, aws.StringValue(in.DetectorId)+"/"+fmt.Sprint(aws.StringValueSlice(in.FindingIds)))
+	return &guardduty.ArchiveFindingsOutput{}, nil
+}
+
+func TestOrganizationArchive(t *testing.T) {
+	clients := make(map[string]*fakeGuardDuty)
+	o := &Organization{
+		Self:    "111111111111",
+		Regions: []string{"us-east-1"},
+		Client: func(account string, region string) guarddutyiface.GuardDutyAPI {
+			clients[account+"/"+region] = newFakeGuardDuty(0, getFindingsMax)
+			return clients[account+"/"+region]
+		},
+	}
+	// a member's finding seen by the administrator is archived with the administrator's detector
+	if err := o.Archive("222222222222", "", "d1", []string{"f1"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	// one from another account's detector needs the role
+	if err := o.Archive("333333333333", "eu-west-1", "d9", []string{"f2"}, ""); err == nil {
+		t.Error("expected an error without a role name")
+	}
+	o.RoleName = "guardduty-logs"
+	if err := o.Archive("333333333333", "eu-west-1", "d9", []string{"f2"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(clients["111111111111/us-east-1"].archived, clients["333333333333/eu-west-1"].archived); got != "[d1/[f1]] [d9/[f2]]" {
+		t.Errorf("unexpected archive calls %s", got)
+	}
+}
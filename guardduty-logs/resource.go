@@ -0,0 +1,174 @@
+package guarddutylogs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+)
+
+// addResource populates the details of whichever resources are present in a finding.
+func (l *LogEntry) addResource(r *guardduty.Resource) {
+	if r == nil {
+		return
+	}
+	l.ResourceType = aws.StringValue(r.ResourceType)
+	if r.InstanceDetails != nil {
+		l.addInstance(r.InstanceDetails)
+	}
+	if r.AccessKeyDetails != nil {
+		l.addAccessKey(r.AccessKeyDetails)
+	}
+	for _, b := range r.S3BucketDetails {
+		l.addS3Bucket(b)
+	}
+	if r.EksClusterDetails != nil {
+		l.addEksCluster(r.EksClusterDetails)
+	}
+	if r.KubernetesDetails != nil {
+		l.addKubernetes(r.KubernetesDetails)
+	}
+	if r.EcsClusterDetails != nil {
+		l.addEcsCluster(r.EcsClusterDetails)
+	}
+	if r.ContainerDetails != nil {
+		l.addContainer(r.ContainerDetails)
+	}
+	if r.LambdaDetails != nil {
+		l.addLambda(r.LambdaDetails)
+	}
+	if r.RdsDbInstanceDetails != nil {
+		l.addRdsInstance(r.RdsDbInstanceDetails)
+	}
+	if r.RdsDbUserDetails != nil {
+		l.addRdsUser(r.RdsDbUserDetails)
+	}
+	if r.EbsVolumeDetails != nil {
+		for _, v := range r.EbsVolumeDetails.ScannedVolumeDetails {
+			if v != nil {
+				l.EbsVolumeArn = append(l.EbsVolumeArn, aws.StringValue(v.VolumeArn))
+			}
+		}
+	}
+}
+
+// addTags merges resource tags into ResourceTags
+func (l *LogEntry) addTags(tags []*guardduty.Tag) {
+	for _, t := range tags {
+		if t == nil {
+			continue
+		}
+		if l.ResourceTags == nil {
+			l.ResourceTags = make(map[string]string)
+		}
+		l.ResourceTags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+}
+
+// addS3Bucket populates information about a bucket in an S3 protection finding.
+func (l *LogEntry) addS3Bucket(b *guardduty.S3BucketDetail) {
+	if b == nil {
+		return
+	}
+	l.S3BucketName = append(l.S3BucketName, aws.StringValue(b.Name))
+	l.S3BucketArn = append(l.S3BucketArn, aws.StringValue(b.Arn))
+	l.S3BucketType = append(l.S3BucketType, aws.StringValue(b.Type))
+	if b.Owner != nil {
+		l.S3BucketOwner = append(l.S3BucketOwner, aws.StringValue(b.Owner.Id))
+	}
+	if b.PublicAccess != nil {
+		l.S3BucketPublic = append(l.S3BucketPublic, aws.StringValue(b.PublicAccess.EffectivePermission))
+	}
+	for _, o := range b.S3ObjectDetails {
+		if o != nil {
+			l.S3ObjectKey = append(l.S3ObjectKey, aws.StringValue(o.Key))
+		}
+	}
+	l.addTags(b.Tags)
+}
+
+// addEksCluster populates information about the EKS cluster in an EKS protection finding.
+func (l *LogEntry) addEksCluster(e *guardduty.EksClusterDetails) {
+	l.EksClusterName = aws.StringValue(e.Name)
+	l.EksClusterArn = aws.StringValue(e.Arn)
+	l.EksClusterStatus = aws.StringValue(e.Status)
+	l.EksClusterVpc = aws.StringValue(e.VpcId)
+	l.addTags(e.Tags)
+}
+
+// addKubernetes populates the kubernetes user and workload involved in a finding.
+func (l *LogEntry) addKubernetes(k *guardduty.KubernetesDetails) {
+	if u := k.KubernetesUserDetails; u != nil {
+		l.K8sUser = aws.StringValue(u.Username)
+		l.K8sUserUid = aws.StringValue(u.Uid)
+		l.K8sGroups = aws.StringValueSlice(u.Groups)
+		if u.ImpersonatedUser != nil {
+			l.K8sImpersonatedUser = aws.StringValue(u.ImpersonatedUser.Username)
+		}
+	}
+	if w := k.KubernetesWorkloadDetails; w != nil {
+		l.K8sWorkloadName = aws.StringValue(w.Name)
+		l.K8sWorkloadNamespace = aws.StringValue(w.Namespace)
+		l.K8sWorkloadType = aws.StringValue(w.Type)
+		l.K8sServiceAccount = aws.StringValue(w.ServiceAccountName)
+		l.K8sHostNetwork = aws.BoolValue(w.HostNetwork)
+		for _, c := range w.Containers {
+			l.addContainer(c)
+		}
+	}
+}
+
+// addEcsCluster populates the ECS cluster and task involved in a finding.
+func (l *LogEntry) addEcsCluster(e *guardduty.EcsClusterDetails) {
+	l.EcsClusterName = aws.StringValue(e.Name)
+	l.EcsClusterArn = aws.StringValue(e.Arn)
+	l.EcsClusterStatus = aws.StringValue(e.Status)
+	l.addTags(e.Tags)
+	if t := e.TaskDetails; t != nil {
+		l.EcsTaskArn = aws.StringValue(t.Arn)
+		l.EcsTaskDef = aws.StringValue(t.DefinitionArn)
+		for _, c := range t.Containers {
+			l.addContainer(c)
+		}
+		l.addTags(t.Tags)
+	}
+}
+
+// addContainer appends a container's details.
+func (l *LogEntry) addContainer(c *guardduty.Container) {
+	if c == nil {
+		return
+	}
+	l.ContainerId = append(l.ContainerId, aws.StringValue(c.Id))
+	l.ContainerName = append(l.ContainerName, aws.StringValue(c.Name))
+	l.ContainerImage = append(l.ContainerImage, aws.StringValue(c.Image))
+}
+
+// addLambda populates information about the Lambda function in a finding.
+func (l *LogEntry) addLambda(f *guardduty.LambdaDetails) {
+	l.LambdaName = aws.StringValue(f.FunctionName)
+	l.LambdaArn = aws.StringValue(f.FunctionArn)
+	l.LambdaVersion = aws.StringValue(f.FunctionVersion)
+	l.LambdaRole = aws.StringValue(f.Role)
+	if f.VpcConfig != nil {
+		l.LambdaVpc = aws.StringValue(f.VpcConfig.VpcId)
+	}
+	l.addTags(f.Tags)
+}
+
+// addRdsInstance populates information about the database in an RDS protection finding.
+func (l *LogEntry) addRdsInstance(r *guardduty.RdsDbInstanceDetails) {
+	l.RdsInstanceId = aws.StringValue(r.DbInstanceIdentifier)
+	l.RdsInstanceArn = aws.StringValue(r.DbInstanceArn)
+	l.RdsClusterId = aws.StringValue(r.DbClusterIdentifier)
+	l.RdsEngine = aws.StringValue(r.Engine)
+	l.RdsEngineVersion = aws.StringValue(r.EngineVersion)
+	l.addTags(r.Tags)
+}
+
+// addRdsUser populates information about the database user in an RDS protection finding.
+func (l *LogEntry) addRdsUser(u *guardduty.RdsDbUserDetails) {
+	l.RdsUser = aws.StringValue(u.User)
+	l.RdsApplication = aws.StringValue(u.Application)
+	l.RdsDatabase = aws.StringValue(u.Database)
+	l.RdsAuthMethod = aws.StringValue(u.AuthMethod)
+	l.RdsSsl = aws.StringValue(u.Ssl)
+}
@@ -0,0 +1,39 @@
+package guarddutylogs
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"log"
+)
+
+// HandleSQSEvent processes a batch of SQS messages, each holding a GuardDuty finding event forwarded by EventBridge,
+// and calls emit with the log entries for each finding. Messages that can't be decoded or flattened, or where emit
+// fails, are returned as batch item failures so only they are retried. The event source mapping needs
+// ReportBatchItemFailures enabled for this to work.
+func HandleSQSEvent(ctx context.Context, event events.SQSEvent, emit func([]LogEntry) error) events.SQSEventResponse {
+	response := events.SQSEventResponse{BatchItemFailures: make([]events.SQSBatchItemFailure, 0)}
+	for _, msg := range event.Records {
+		if err := handleMessage(msg, emit); err != nil {
+			log.Printf("failed to process message %s: %v\n", msg.MessageId, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: msg.MessageId})
+		}
+	}
+	return response
+}
+
+func handleMessage(msg events.SQSMessage, emit func([]LogEntry) error) error {
+	cwEvent := &events.CloudWatchEvent{}
+	if err := json.Unmarshal([]byte(msg.Body), cwEvent); err != nil {
+		return err
+	}
+	finding, err := ParseEvent(&cwEvent.Detail)
+	if err != nil {
+		return err
+	}
+	logs, err := NewLogs(finding)
+	if err != nil {
+		return err
+	}
+	return emit(logs)
+}
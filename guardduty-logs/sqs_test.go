@@ -0,0 +1,36 @@
+package guarddutylogs
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"testing"
+)
+
+func TestHandleSQSEvent(t *testing.T) {
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "good", Body: rawEvents[0]},
+		{MessageId: "not-json", Body: "{"},
+		{MessageId: "invalid", Body: `{"detail-type":"GuardDuty Finding","detail":{"service":{"action":{"actionType":"PORT_PROBE"}}}}`},
+		{MessageId: "emit-fails", Body: rawEvents[1]},
+		{MessageId: "also-good", Body: rawEvents[2]},
+	}}
+	count := 0
+	response := HandleSQSEvent(context.Background(), event, func(logs []LogEntry) error {
+		if logs[0].Id == "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" {
+			return errors.New("downstream is unavailable")
+		}
+		count += len(logs)
+		return nil
+	})
+	if count != 3 {
+		t.Errorf("expected 3 log entries from the good messages, got %d", count)
+	}
+	failed := make([]string, 0)
+	for _, f := range response.BatchItemFailures {
+		failed = append(failed, f.ItemIdentifier)
+	}
+	if len(failed) != 3 || failed[0] != "not-json" || failed[1] != "invalid" || failed[2] != "emit-fails" {
+		t.Errorf("unexpected batch item failures %v", failed)
+	}
+}
@@ -0,0 +1,385 @@
+package guarddutylogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/guardduty"
+	"github.com/blockpane/logsuck/internal/ipaddr"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Rule actions: drop leaves the log entry out, tag prints it with suppressed and suppressed_by set, and archive tags
+// it and archives the finding in GuardDuty.
+const (
+	ActionDrop    = "drop"
+	ActionTag     = "tag"
+	ActionArchive = "archive"
+)
+
+// Rule suppresses the log entries that match every one of its conditions.
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// Feedback is optional for archive rules, USEFUL or NOT_USEFUL is sent to GuardDuty along with archiving.
+	Feedback string      `json:"feedback,omitempty"`
+	Match    []Condition `json:"match"`
+}
+
+// Condition tests one field of a log entry, using its JSON name. Map fields take a key after a dot, like
+// instance_tags.Name, and for list fields like threat_list_names any element can match. The ops are:
+//
+// equals, not_equals, prefix, suffix and contains compare the value as a string with each of Values, not_equals
+// matches when none of them are equal. cidr matches an IP in any of the networks in Values, gte and lte compare a
+// number with the first of Values, and exists and missing test if the field has a value at all.
+type Condition struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Values []string `json:"values,omitempty"`
+
+	nets  []*net.IPNet
+	bound float64
+}
+
+// SuppressionAudit is logged each time a rule fires, so there is a record of what was hidden and why.
+type SuppressionAudit struct {
+	Rule      string `json:"rule"`
+	Action    string `json:"action"`
+	FindingId string `json:"finding_id"`
+	AccountId string `json:"account_id,omitempty"`
+	Region    string `json:"region,omitempty"`
+	EventType string `json:"event_type,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Archiver archives findings in GuardDuty using the detector in the findings' account and region, *Organization is
+// one.
+type Archiver interface {
+	Archive(account string, region string, detector string, ids []string, feedback string) error
+}
+
+// Archive archives the findings and, if feedback is set, sends it as well.
+func (p *Poller) Archive(detector string, ids []string, feedback string) error {
+	if feedback != "" {
+		_, err := p.GuardDuty.UpdateFindingsFeedback(&guardduty.UpdateFindingsFeedbackInput{
+			DetectorId: aws.String(detector),
+			FindingIds: aws.StringSlice(ids),
+			Feedback:   aws.String(feedback),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := p.GuardDuty.ArchiveFindings(&guardduty.ArchiveFindingsInput{
+		DetectorId: aws.String(detector),
+		FindingIds: aws.StringSlice(ids),
+	})
+	return err
+}
+
+// Suppressor applies suppression rules to log entries. A nil *Suppressor passes everything through.
+type Suppressor struct {
+	Rules []Rule
+	// Archiver is used by archive rules, without one they only tag.
+	Archiver Archiver
+	// Audit is called for each rule that fires, the default logs the audit as JSON.
+	Audit func(SuppressionAudit)
+}
+
+// ReadRules decodes a JSON list of rules, they are checked by NewSuppressor.
+func ReadRules(r io.Reader) (rules []Rule, err error) {
+	err = json.NewDecoder(r).Decode(&rules)
+	return
+}
+
+// NewSuppressor checks the rules and returns a Suppressor for them.
+func NewSuppressor(rules []Rule, archiver Archiver) (*Suppressor, error) {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return &Suppressor{Rules: rules, Archiver: archiver}, nil
+}
+
+func (r *Rule) compile() error {
+	switch r.Action {
+	case ActionDrop, ActionTag, ActionArchive:
+	default:
+		return fmt.Errorf("rule %q: unknown action %q", r.Name, r.Action)
+	}
+	if r.Feedback != "" && r.Feedback != guardduty.FeedbackUseful && r.Feedback != guardduty.FeedbackNotUseful {
+		return fmt.Errorf("rule %q: feedback must be %s or %s", r.Name, guardduty.FeedbackUseful, guardduty.FeedbackNotUseful)
+	}
+	if len(r.Match) == 0 {
+		return fmt.Errorf("rule %q: has no conditions", r.Name)
+	}
+	for i := range r.Match {
+		if err := r.Match[i].compile(); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) compile() error {
+	if c.Field == "" {
+		return fmt.Errorf("condition has no field")
+	}
+	switch c.Op {
+	case "exists", "missing":
+		return nil
+	case "equals", "not_equals", "prefix", "suffix", "contains":
+	case "cidr":
+		c.nets = nil
+		for _, v := range c.Values {
+			_, n, err := net.ParseCIDR(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", c.Field, err)
+			}
+			c.nets = append(c.nets, n)
+		}
+	case "gte", "lte":
+		if len(c.Values) == 0 {
+			break
+		}
+		f, err := strconv.ParseFloat(c.Values[0], 64)
+		if err != nil {
+			return fmt.Errorf("%s: %s needs a number: %v", c.Field, c.Op, err)
+		}
+		c.bound = f
+	default:
+		return fmt.Errorf("%s: unknown op %q", c.Field, c.Op)
+	}
+	if len(c.Values) == 0 {
+		return fmt.Errorf("%s: %s needs values", c.Field, c.Op)
+	}
+	return nil
+}
+
+// detectorKey is where a finding lives, archive calls are grouped by it.
+type detectorKey struct {
+	account  string
+	region   string
+	detector string
+}
+
+// Apply runs the rules over logs, the entries for one finding that are going to be printed, usually those the
+// Deduper hasn't seen, and finding is every entry for it. The first rule that matches an entry decides what happens
+// to it. A finding is only archived if every one of its entries matched an archive rule, otherwise a port probe from
+// one allowed scanner could archive the probes from everyone else, so those entries are just tagged. Archiving
+// errors are recorded in the audit and the entries tagged, so GuardDuty being unavailable doesn't stop findings being
+// logged.
+func (s *Suppressor) Apply(finding []LogEntry, logs []LogEntry) []LogEntry {
+	if s == nil || len(s.Rules) == 0 || len(logs) == 0 {
+		return logs
+	}
+	var archive *Rule
+	archiveAll := true
+	for _, l := range finding {
+		r := s.match(l)
+		if r == nil || r.Action != ActionArchive {
+			archiveAll = false
+		} else if archive == nil {
+			archive = r
+		}
+	}
+
+	archived := make(map[detectorKey]bool)
+	errs := make(map[detectorKey]error)
+	if archiveAll && archive != nil && s.Archiver != nil {
+		groups := make(map[detectorKey][]string)
+		keys := make([]detectorKey, 0)
+		for _, l := range finding {
+			k := detectorKey{l.AccountId, l.Region, l.DetectorId}
+			if l.Archived || contains(groups[k], l.Id) {
+				continue
+			}
+			if groups[k] == nil {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], l.Id)
+		}
+		for _, k := range keys {
+			errs[k] = s.Archiver.Archive(k.account, k.region, k.detector, groups[k], archive.Feedback)
+			archived[k] = errs[k] == nil
+		}
+	}
+
+	out := make([]LogEntry, 0, len(logs))
+	for _, l := range logs {
+		r := s.match(l)
+		if r == nil {
+			out = append(out, l)
+			continue
+		}
+		k := detectorKey{l.AccountId, l.Region, l.DetectorId}
+		action, detail := r.Action, ""
+		if action == ActionArchive && !archived[k] {
+			action = ActionTag
+			switch {
+			case errs[k] != nil:
+				detail = "archive failed: " + errs[k].Error()
+			case s.Archiver == nil:
+				detail = "not archived, there is no archiver"
+			case !archiveAll:
+				detail = "not archived, only some entries for the finding matched"
+			case l.Archived:
+				detail = "already archived"
+			}
+		}
+		s.audit(SuppressionAudit{
+			Rule:      r.Name,
+			Action:    action,
+			FindingId: l.Id,
+			AccountId: l.AccountId,
+			Region:    l.Region,
+			EventType: l.EventType,
+			Detail:    detail,
+		})
+		if r.Action == ActionDrop {
+			continue
+		}
+		l.Suppressed = true
+		l.SuppressedBy = r.Name
+		out = append(out, l)
+	}
+	return out
+}
+
+func (s *Suppressor) audit(a SuppressionAudit) {
+	if s.Audit != nil {
+		s.Audit(a)
+		return
+	}
+	j, _ := json.Marshal(a)
+	log.Println("suppression rule fired:", string(j))
+}
+
+// match returns the first rule where every condition holds for the entry, or nil.
+func (s *Suppressor) match(l LogEntry) *Rule {
+	fields := make(map[string]interface{})
+	j, _ := json.Marshal(l)
+	_ = json.Unmarshal(j, &fields)
+rules:
+	for i := range s.Rules {
+		for _, c := range s.Rules[i].Match {
+			if !c.matches(lookup(fields, c.Field)) {
+				continue rules
+			}
+		}
+		return &s.Rules[i]
+	}
+	return nil
+}
+
+// lookup finds a field by its JSON name, or a key in a map field with name.key, and returns its values as strings.
+func lookup(fields map[string]interface{}, name string) []string {
+	v, ok := fields[name]
+	if !ok {
+		if i := strings.Index(name, "."); i > 0 {
+			if m, isMap := fields[name[:i]].(map[string]interface{}); isMap {
+				v, ok = m[name[i+1:]]
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	switch val := v.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(val))
+		for _, e := range val {
+			values = append(values, fieldString(e))
+		}
+		return values
+	case map[string]interface{}:
+		values := make([]string, 0, len(val))
+		for k := range val {
+			values = append(values, k)
+		}
+		return values
+	}
+	return []string{fieldString(v)}
+}
+
+func fieldString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func (c Condition) matches(values []string) bool {
+	present := false
+	for _, v := range values {
+		if v != "" {
+			present = true
+		}
+	}
+	switch c.Op {
+	case "exists":
+		return present
+	case "missing":
+		return !present
+	case "not_equals":
+		for _, v := range values {
+			if contains(c.Values, v) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if c.test(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) test(v string) bool {
+	switch c.Op {
+	case "equals":
+		return contains(c.Values, v)
+	case "prefix", "suffix", "contains":
+		for _, want := range c.Values {
+			if (c.Op == "prefix" && strings.HasPrefix(v, want)) || (c.Op == "suffix" && strings.HasSuffix(v, want)) ||
+				(c.Op == "contains" && strings.Contains(v, want)) {
+				return true
+			}
+		}
+	case "cidr":
+		ip := ipaddr.Parse(v)
+		for _, n := range c.nets {
+			if ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+	case "gte", "lte":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		return (c.Op == "gte" && f >= c.bound) || (c.Op == "lte" && f <= c.bound)
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
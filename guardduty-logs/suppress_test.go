@@ -0,0 +1,188 @@
+package guarddutylogs
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"strings"
+	"testing"
+)
+
+type fakeArchiver struct {
+	calls    []string
+	feedback string
+	err      error
+}
+
+func (f *fakeArchiver) Archive(account string, region string, detector string, ids []string, feedback string) error {
+	f.calls = append(f.calls, account+"/"+region+"/"+detector+"/"+strings.Join(ids, ","))
+	f.feedback = feedback
+	return f.err
+}
+
+// probeLogs is the port probe finding, one entry from 22.22.222.22 in China to port 22 and one from 11.22.222.111 in
+// Germany to port 8889.
+func probeLogs(t *testing.T) []LogEntry {
+	cwEvent := &events.CloudWatchEvent{}
+	if err := json.Unmarshal([]byte(rawEvents[0]), cwEvent); err != nil {
+		t.Fatal(err)
+	}
+	finding, err := ParseEvent(&cwEvent.Detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := NewLogs(finding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+func TestSuppressor(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    string
+		archiver *fakeArchiver
+		logs     int
+		tagged   int
+		archived int
+		audits   []string
+	}{
+		{
+			name:   "tag one port",
+			rules:  `[{"name":"ssh","action":"tag","match":[{"field":"dest_port","op":"equals","values":["22","3389"]}]}]`,
+			logs:   2,
+			tagged: 1,
+			audits: []string{"ssh tag "},
+		},
+		{
+			name: "drop by country and threat list",
+			rules: `[{"name":"de","action":"drop","match":[{"field":"remote_ip_country","op":"equals","values":["Germany"]},
+				{"field":"threat_list_names","op":"equals","values":["ProofPoint"]}]}]`,
+			logs:   1,
+			audits: []string{"de drop "},
+		},
+		{
+			name:   "no match",
+			rules:  `[{"name":"high","action":"drop","match":[{"field":"severity","op":"gte","values":["7"]}]}]`,
+			logs:   2,
+			audits: []string{},
+		},
+		{
+			name: "archive whole finding",
+			rules: `[{"name":"demo","action":"archive","feedback":"NOT_USEFUL","match":[{"field":"instance_tags.Name","op":"equals","values":["DEMO"]},
+				{"field":"event_type","op":"prefix","values":["Recon:"]},{"field":"src_ip","op":"cidr","values":["0.0.0.0/0"]}]}]`,
+			archiver: &fakeArchiver{},
+			logs:     2,
+			tagged:   2,
+			archived: 1,
+			audits:   []string{"demo archive ", "demo archive "},
+		},
+		{
+			name:     "archive part of a finding",
+			rules:    `[{"name":"cn","action":"archive","match":[{"field":"src_ip","op":"cidr","values":["22.22.0.0/16"]}]}]`,
+			archiver: &fakeArchiver{},
+			logs:     2,
+			tagged:   1,
+			audits:   []string{"cn tag not archived, only some entries for the finding matched"},
+		},
+		{
+			name:     "archive fails",
+			rules:    `[{"name":"all","action":"archive","match":[{"field":"instance_id","op":"exists"}]}]`,
+			archiver: &fakeArchiver{err: errors.New("access denied")},
+			logs:     2,
+			tagged:   2,
+			archived: 1,
+			audits:   []string{"all tag archive failed: access denied", "all tag archive failed: access denied"},
+		},
+	}
+	for _, tt := range tests {
+		rules, err := ReadRules(strings.NewReader(tt.rules))
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+		var archiver Archiver
+		if tt.archiver != nil {
+			archiver = tt.archiver
+		}
+		s, err := NewSuppressor(rules, archiver)
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+		audits := make([]string, 0)
+		s.Audit = func(a SuppressionAudit) {
+			if a.FindingId != "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" {
+				t.Errorf("%s: audit has finding id %q", tt.name, a.FindingId)
+			}
+			audits = append(audits, a.Rule+" "+a.Action+" "+a.Detail)
+		}
+		probes := probeLogs(t)
+		logs := s.Apply(probes, probes)
+		if len(logs) != tt.logs {
+			t.Errorf("%s: expected %d logs, got %d", tt.name, tt.logs, len(logs))
+		}
+		tagged := 0
+		for _, l := range logs {
+			if l.Suppressed && l.SuppressedBy == rules[0].Name {
+				tagged++
+			}
+		}
+		if tagged != tt.tagged {
+			t.Errorf("%s: expected %d tagged, got %d", tt.name, tt.tagged, tagged)
+		}
+		if tt.archiver != nil && len(tt.archiver.calls) != tt.archived {
+			t.Errorf("%s: expected %d archive calls, got %v", tt.name, tt.archived, tt.archiver.calls)
+		}
+		if strings.Join(audits, "|") != strings.Join(tt.audits, "|") {
+			t.Errorf("%s: expected audits %q, got %q", tt.name, tt.audits, audits)
+		}
+	}
+
+	a := &fakeArchiver{}
+	rules, _ := ReadRules(strings.NewReader(`[{"name":"demo","action":"archive","feedback":"NOT_USEFUL","match":[{"field":"resource_role","op":"equals","values":["TARGET"]}]}]`))
+	s, _ := NewSuppressor(rules, a)
+	s.Audit = func(SuppressionAudit) {}
+	probes := probeLogs(t)
+	s.Apply(probes, probes)
+	if a.calls[0] != "112233445566/us-east-1/11111111111111111111111111111111/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" || a.feedback != "NOT_USEFUL" {
+		t.Errorf("archived %v with feedback %q", a.calls, a.feedback)
+	}
+
+	// only the entry the Deduper let through is printed, but the other entry still stops the finding being archived
+	a = &fakeArchiver{}
+	rules, _ = ReadRules(strings.NewReader(`[{"name":"cn","action":"archive","match":[{"field":"src_ip","op":"cidr","values":["22.22.0.0/16"]}]}]`))
+	s, _ = NewSuppressor(rules, a)
+	s.Audit = func(SuppressionAudit) {}
+	for _, l := range probes {
+		if l.SrcIp == "22.22.222.22" {
+			if logs := s.Apply(probes, []LogEntry{l}); len(logs) != 1 || len(a.calls) != 0 {
+				t.Errorf("expected the new entry tagged and nothing archived, got %+v and %v", logs, a.calls)
+			}
+		}
+	}
+
+	var none *Suppressor
+	if logs := none.Apply(probes, probes); len(logs) != 2 {
+		t.Error("nil suppressor should pass everything through")
+	}
+}
+
+func TestNewSuppressorInvalid(t *testing.T) {
+	for _, rules := range []string{
+		`[{"name":"a","action":"hide","match":[{"field":"port","op":"equals","values":["22"]}]}]`,
+		`[{"name":"a","action":"drop","match":[]}]`,
+		`[{"name":"a","action":"drop","match":[{"field":"port","op":"like","values":["22"]}]}]`,
+		`[{"name":"a","action":"drop","match":[{"field":"port","op":"equals"}]}]`,
+		`[{"name":"a","action":"drop","match":[{"field":"src_ip","op":"cidr","values":["10.0.0.0"]}]}]`,
+		`[{"name":"a","action":"drop","match":[{"field":"severity","op":"gte","values":["high"]}]}]`,
+		`[{"name":"a","action":"archive","feedback":"MEH","match":[{"field":"port","op":"exists"}]}]`,
+	} {
+		r, err := ReadRules(strings.NewReader(rules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = NewSuppressor(r, nil); err == nil {
+			t.Errorf("expected an error for %s", rules)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package flatten turns the free form JSON objects some services attach to events into flat string maps, so they
+// can be logged as dotted fields without each log line having a different shape.
+package flatten
+
+import (
+	"encoding/json"
+)
+
+// Map walks a decoded JSON object and writes every leaf value into out as a string, keyed by its path joined with
+// dots after prefix. Strings are kept as they are, nulls are left out and anything else is written as JSON.
+func Map(prefix string, in map[string]interface{}, out map[string]string) {
+	for k, v := range in {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]interface{}:
+			Map(k, val, out)
+		case string:
+			out[k] = val
+		case nil:
+			continue
+		default:
+			j, _ := json.Marshal(val)
+			out[k] = string(j)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package flatten
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	in := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(`{"a":"x","b":{"c":1,"d":{"e":true}},"f":null,"g":["y","z"]}`), &in); err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]string)
+	Map("meta", in, out)
+	expected := map[string]string{"meta.a": "x", "meta.b.c": "1", "meta.b.d.e": "true", "meta.g": `["y","z"]`}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+}
@@ -0,0 +1,49 @@
+// Package ipaddr validates and normalizes the IP addresses logged by each of the collectors, so IPv4 and IPv6
+// addresses look the same no matter which service they came from.
+package ipaddr
+
+import (
+	"net"
+	"strings"
+)
+
+// Parse accepts an IPv4 or IPv6 address, optionally wrapped in brackets or followed by a zone, and returns nil if
+// it isn't valid. IPv4 addresses, including IPv4-mapped IPv6 addresses, are returned in their 4 byte form.
+func Parse(s string) net.IP {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// Normalize returns the canonical string form of an address and its version. If s isn't a valid address it is
+// returned unchanged with a version of 0, so nothing is lost from the log.
+func Normalize(s string) (string, int) {
+	ip := Parse(s)
+	if ip == nil {
+		return s, 0
+	}
+	return ip.String(), Version(ip)
+}
+
+// Version returns 4 or 6, or 0 for an empty or invalid address.
+func Version(ip net.IP) int {
+	switch {
+	case ip == nil:
+		return 0
+	case ip.To4() != nil:
+		return 4
+	case ip.To16() != nil:
+		return 6
+	}
+	return 0
+}
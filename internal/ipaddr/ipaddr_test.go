@@ -0,0 +1,27 @@
+package ipaddr
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		out     string
+		version int
+	}{
+		{"192.0.2.1", "192.0.2.1", 4},
+		{" 192.0.2.1\n", "192.0.2.1", 4},
+		{"::ffff:192.0.2.1", "192.0.2.1", 4},
+		{"2001:DB8:0:0:0:0:0:1", "2001:db8::1", 6},
+		{"[2001:db8::1]", "2001:db8::1", 6},
+		{"fe80::1%eth0", "fe80::1", 6},
+		{"", "", 0},
+		{"not an ip", "not an ip", 0},
+	} {
+		out, version := Normalize(tc.in)
+		if out != tc.out || version != tc.version {
+			t.Errorf("Normalize(%q) = %q, %d; expected %q, %d", tc.in, out, version, tc.out, tc.version)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package ndjson reads the newline delimited JSON files, usually gzipped, that services export to S3 or push over
+// HTTP, one record at a time so large files never need to fit in memory.
+package ndjson
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ErrTooLarge is returned when a file is bigger than the limit it's read with
+var ErrTooLarge = errors.New("larger than the size limit")
+
+// LimitReader is io.LimitReader, but returns ErrTooLarge rather than stopping early, so a file that's too big isn't
+// mistaken for a shorter one.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	return &limitReader{r: r, n: n}
+}
+
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// at the limit, only an EOF is fine
+		n, err := l.r.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// Decode calls emit with each record in r without decoding it, r is gunzipped if it starts with the gzip magic
+// number. maxDecoded limits the size once decompressed, zero means no limit.
+func Decode(r io.Reader, maxDecoded int64, emit func(json.RawMessage) error) (count int, err error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	var in io.Reader = br
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	if maxDecoded > 0 {
+		in = LimitReader(in, maxDecoded)
+	}
+
+	dec := json.NewDecoder(in)
+	for {
+		raw := json.RawMessage{}
+		err = dec.Decode(&raw)
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		if err = emit(raw); err != nil {
+			return count, err
+		}
+		count += 1
+	}
+}
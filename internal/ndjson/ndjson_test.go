@@ -0,0 +1,39 @@
+package ndjson
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	plain := strings.Repeat(`{"a":1}`+"\n", 3)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(plain))
+	w.Close()
+
+	for name, body := range map[string][]byte{"plain": []byte(plain), "gzip": gz.Bytes()} {
+		count, err := Decode(bytes.NewReader(body), 0, func(raw json.RawMessage) error {
+			if string(raw) != `{"a":1}` {
+				t.Errorf("%s: unexpected record %s", name, raw)
+			}
+			return nil
+		})
+		if err != nil || count != 3 {
+			t.Errorf("%s: expected 3 records, got %d, %v", name, count, err)
+		}
+	}
+
+	// the limit applies to the decompressed size, exactly at the limit is fine
+	if _, err := Decode(bytes.NewReader(gz.Bytes()), int64(len(plain)), func(json.RawMessage) error { return nil }); err != nil {
+		t.Errorf("expected a file at the limit to be read, got %v", err)
+	}
+	count, err := Decode(bytes.NewReader(gz.Bytes()), 10, func(json.RawMessage) error { return nil })
+	if !errors.Is(err, ErrTooLarge) || count != 1 {
+		t.Errorf("expected ErrTooLarge after 1 record, got %d, %v", count, err)
+	}
+}
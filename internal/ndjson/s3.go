@@ -0,0 +1,44 @@
+package ndjson
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// HandleS3Event fetches each object from the S3 ObjectCreated notifications in event and passes it to read, which
+// returns how many records it processed. Processing stops at the first error. unit names the records in the log,
+// for example "findings".
+func HandleS3Event(ctx context.Context, svc s3iface.S3API, event events.S3Event, unit string, read func(key string, body io.Reader) (int, error)) error {
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated") {
+			continue
+		}
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+		obj, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(record.S3.Bucket.Name),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			log.Printf("could not get s3://%s/%s: %v\n", record.S3.Bucket.Name, key, err)
+			return err
+		}
+		count, err := read(key, obj.Body)
+		obj.Body.Close()
+		if err != nil {
+			log.Printf("error decoding s3://%s/%s after %d %s: %v\n", record.S3.Bucket.Name, key, count, unit, err)
+			return err
+		}
+		log.Printf("processed %d %s from s3://%s/%s\n", count, unit, record.S3.Bucket.Name, key)
+	}
+	return nil
+}
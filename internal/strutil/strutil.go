@@ -0,0 +1,15 @@
+// Package strutil has the string helpers the collectors share that the Go version this module targets doesn't have.
+package strutil
+
+import (
+	"strings"
+)
+
+// Cut is strings.Cut: it slices s around the first sep, returning the text before and after it and whether it was
+// found. If sep isn't in s, before is s and after is empty.
+func Cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
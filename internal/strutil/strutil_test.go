@@ -0,0 +1,23 @@
+package strutil
+
+import (
+	"testing"
+)
+
+func TestCut(t *testing.T) {
+	for _, tt := range []struct {
+		s, sep, before, after string
+		found                 bool
+	}{
+		{"Recon:EC2/PortProbe", ":", "Recon", "EC2/PortProbe", true},
+		{"a::b", "::", "a", "b", true},
+		{"a:b:c", ":", "a", "b:c", true},
+		{"abc", ":", "abc", "", false},
+		{"", ":", "", "", false},
+	} {
+		before, after, found := Cut(tt.s, tt.sep)
+		if before != tt.before || after != tt.after || found != tt.found {
+			t.Errorf("Cut(%q, %q) = %q, %q, %v", tt.s, tt.sep, before, after, found)
+		}
+	}
+}
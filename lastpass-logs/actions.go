@@ -0,0 +1,123 @@
+package lastpasslogs
+
+import (
+	"github.com/blockpane/logsuck/internal/strutil"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The meaning of an event's Data depends on its action. These parsers pull out the parts that alerts care about,
+// Detail always keeps the raw string. Formats seen so far:
+//
+//	Open Site, Add Site, Edit Site, Delete Site, Deleted Sites:  the site's name or URL
+//	Add to Shared Folder, Remove from Shared Folder:              "Shared-Finance user@example.com"
+//	Make Admin, Employee Account Created, Disable User, ...:      the user being changed
+//	Policy Changed, Policy Added, Policy Removed:                 "Policy name: value" or "... from old to new"
+//
+// Anything else only gets old and new values when Data reads "... from old to new".
+var actionParsers = map[string]func(l *LastpassLog, data string){
+	"open site":                        parseSite,
+	"add site":                         parseSite,
+	"edit site":                        parseSite,
+	"delete site":                      parseSite,
+	"deleted sites":                    parseSite,
+	"site opened":                      parseSite,
+	"add to shared folder":             parseSharedFolder,
+	"remove from shared folder":        parseSharedFolder,
+	"move to shared folder":            parseSharedFolder,
+	"create shared folder":             parseSharedFolder,
+	"delete shared folder":             parseSharedFolder,
+	"shared folder permissions":        parseSharedFolder,
+	"make admin":                       parseTargetUser,
+	"remove admin":                     parseTargetUser,
+	"employee account created":         parseTargetUser,
+	"employee account deleted":         parseTargetUser,
+	"employee account disabled":        parseTargetUser,
+	"disable user":                     parseTargetUser,
+	"enable user":                      parseTargetUser,
+	"require password change":          parseTargetUser,
+	"super admin password reset":       parseTargetUser,
+	"reset user password":              parseTargetUser,
+	"master password changed":          parseTargetUser,
+	"change master password":           parseTargetUser,
+	"policy changed":                   parsePolicy,
+	"policy added":                     parsePolicy,
+	"policy removed":                   parsePolicy,
+	"policy users changed":             parsePolicy,
+	"federated login settings changed": parsePolicy,
+}
+
+var (
+	emailPattern  = regexp.MustCompile(`[^\s@:,;]+@[^\s@:,;]+\.[^\s@:,;]+`)
+	changePattern = regexp.MustCompile(`(?i)\bfrom\s+(.*?)\s+to\s+(.*)$`)
+)
+
+// parseData fills in the structured fields for the event's action
+func (l *LastpassLog) parseData(action, data string) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return
+	}
+	if parse, ok := actionParsers[strings.ToLower(strings.TrimSpace(action))]; ok {
+		parse(l, data)
+		return
+	}
+	parseChange(l, data)
+}
+
+// parseSite sets Site, and Url if Data is a URL rather than a name. Some bulk actions only give a count.
+func parseSite(l *LastpassLog, data string) {
+	if strings.Trim(data, "0123456789") == "" {
+		return
+	}
+	l.Site = data
+	if u, err := url.Parse(data); err == nil && u.Scheme != "" && u.Host != "" {
+		l.Url = data
+		l.Site = u.Hostname()
+	}
+}
+
+// parseSharedFolder takes the user out of Data, what's left is the folder's name
+func parseSharedFolder(l *LastpassLog, data string) {
+	user := emailPattern.FindString(data)
+	l.TargetUser = user
+	l.SharedFolder = strings.TrimSpace(strings.Replace(data, user, "", 1))
+	if user == "" {
+		l.SharedFolder = data
+	}
+}
+
+// parseTargetUser sets the user an admin action was done to, which is an email address in Data
+func parseTargetUser(l *LastpassLog, data string) {
+	if user := emailPattern.FindString(data); user != "" {
+		l.TargetUser = user
+		return
+	}
+	if !strings.Contains(data, " ") {
+		l.TargetUser = data
+	}
+}
+
+// parsePolicy splits "Policy name: value" or "Policy name from old to new" and looks for a change of value
+func parsePolicy(l *LastpassLog, data string) {
+	policy, value, ok := strutil.Cut(data, ":")
+	if !ok {
+		if m := changePattern.FindStringIndex(data); m != nil {
+			policy, value = data[:m[0]], data[m[0]:]
+		}
+	}
+	l.Policy = strings.TrimSpace(policy)
+	parseChange(l, value)
+	if l.OldValue == "" && l.NewValue == "" {
+		l.NewValue = strings.TrimSpace(value)
+	}
+}
+
+// parseChange sets OldValue and NewValue from "... from old to new"
+func parseChange(l *LastpassLog, data string) {
+	if m := changePattern.FindStringSubmatch(data); m != nil {
+		l.OldValue = strings.TrimSpace(m[1])
+		l.NewValue = strings.TrimSpace(m[2])
+	}
+}
@@ -0,0 +1,38 @@
+package lastpasslogs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseData(t *testing.T) {
+	tests := []struct {
+		action, data string
+		want         LastpassLog
+	}{
+		{"Open Site", "amazon.com", LastpassLog{Site: "amazon.com"}},
+		{"Add Site", "https://github.com/login", LastpassLog{Site: "github.com", Url: "https://github.com/login"}},
+		{"Deleted Sites", "12", LastpassLog{}},
+		{"Add to Shared Folder", "Shared-Finance bob@example.com", LastpassLog{SharedFolder: "Shared-Finance", TargetUser: "bob@example.com"}},
+		{"Remove from Shared Folder", "Shared-Ops", LastpassLog{SharedFolder: "Shared-Ops"}},
+		{"Make Admin", "alice@example.com", LastpassLog{TargetUser: "alice@example.com"}},
+		{"Master Password Changed", "", LastpassLog{}},
+		{"Policy Changed", "Require use of a password generator: Enabled", LastpassLog{Policy: "Require use of a password generator", NewValue: "Enabled"}},
+		{"policy changed", "Length of master password: changed from 12 to 16", LastpassLog{Policy: "Length of master password", OldValue: "12", NewValue: "16"}},
+		{"Policy Changed", "Restrict access by country from None to US, CA", LastpassLog{Policy: "Restrict access by country", OldValue: "None", NewValue: "US, CA"}},
+		{"Change Email", "from old@example.com to new@example.com", LastpassLog{OldValue: "old@example.com", NewValue: "new@example.com"}},
+		{"Log in", "", LastpassLog{}},
+	}
+	for _, tt := range tests {
+		got := LastpassLog{}
+		got.parseData(tt.action, tt.data)
+		if got != tt.want {
+			t.Errorf("%s %q: got %+v, want %+v", tt.action, tt.data, got, tt.want)
+		}
+	}
+
+	l := OrigLastpassLog{Timestamp: "2023-05-01 10:00:00", Action: "Add to Shared Folder", Data: "Shared-Finance bob@example.com"}.ToLog(time.UTC, time.Time{}, time.Time{})
+	if l.Detail != "Shared-Finance bob@example.com" || l.TargetUser != "bob@example.com" {
+		t.Errorf("ToLog should keep the raw data and parse it, got %+v", l)
+	}
+}
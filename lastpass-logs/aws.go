@@ -1,19 +1,81 @@
 package lastpasslogs
 
 import (
+	"encoding/json"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	"log"
 	"os"
 	"strconv"
-	"time"
 )
 
-// GetTokenSSM retrieves a saved oauth2.Token from AWS SSM/Parameter store.
-func GetSSMValues() (secret string, last time.Time, err error) {
-	tokenParam, err := paramStore.GetParameter(
+// maxSeen caps the hashes kept for one second. Seen and Skip can both be full while a query is in progress, so this
+// keeps the checkpoint within a standard 4 KB SSM parameter. Past that, events in the checkpoint's second can be
+// logged twice, but none are lost.
+const maxSeen = 50
+
+// Checkpoint records how far the reporting API has been read. Last is the newest second that events were logged
+// for and Seen the hashes of the events logged in it. Queries start at Last rather than the second after, since more
+// events for that second can turn up later, and skip anything in Seen. While a paged query is in progress From, To
+// and Next hold its window and cursor so the next run can resume it, and Skip is what Seen was when it started.
+type Checkpoint struct {
+	Last int64    `json:"last"`
+	Seen []string `json:"seen,omitempty"`
+	From int64    `json:"from,omitempty"`
+	To   int64    `json:"to,omitempty"`
+	Next int      `json:"next,omitempty"`
+	Skip []string `json:"skip,omitempty"`
+}
+
+// InProgress is true if a paged query was left unfinished
+func (c Checkpoint) InProgress() bool {
+	return c.Next != 0
+}
+
+// add records a logged event, moving Last forward if it is newer
+func (c *Checkpoint) add(l LastpassLog) {
+	switch {
+	case l.Ts > c.Last:
+		c.Last = l.Ts
+		c.Seen = []string{l.Hash}
+	case l.Ts == c.Last:
+		for _, h := range c.Seen {
+			if h == l.Hash {
+				return
+			}
+		}
+		if len(c.Seen) < maxSeen {
+			c.Seen = append(c.Seen, l.Hash)
+		}
+	}
+}
+
+// ParamStore reads the API secret from, and keeps the checkpoint in, SSM parameter store.
+type ParamStore struct {
+	SSM     ssmiface.SSMAPI
+	Details AwsDetails
+}
+
+// NewParamStore returns a ParamStore for the details' region.
+func NewParamStore(details AwsDetails) (*ParamStore, error) {
+	awsSession, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(details.Region),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ParamStore{SSM: ssm.New(awsSession), Details: details}, nil
+}
+
+// GetSSMValues retrieves the API secret and the checkpoint from AWS SSM/Parameter store.
+func (p *ParamStore) GetSSMValues() (secret string, cp Checkpoint, err error) {
+	tokenParam, err := p.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name:           aws.String(awsDetails.TokenParameter),
+			Name:           aws.String(p.Details.TokenParameter),
 			WithDecryption: aws.Bool(true),
 		},
 	)
@@ -21,32 +83,41 @@ func GetSSMValues() (secret string, last time.Time, err error) {
 		return
 	}
 	secret = aws.StringValue(tokenParam.Parameter.Value)
-	timeParam, err := paramStore.GetParameter(
+	timeParam, err := p.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name: aws.String(awsDetails.TimeParameter),
+			Name: aws.String(p.Details.TimeParameter),
 		},
 	)
 	if err != nil {
 		return
 	}
-	ts := aws.StringValue(timeParam.Parameter.Value)
-	i, err := strconv.Atoi(ts)
+	return secret, parseCheckpoint(aws.StringValue(timeParam.Parameter.Value)), nil
+}
+
+// parseCheckpoint reads a saved Checkpoint, older versions only saved the last timestamp as a plain integer.
+func parseCheckpoint(s string) (cp Checkpoint) {
+	if err := json.Unmarshal([]byte(s), &cp); err == nil {
+		return
+	}
+	i, err := strconv.Atoi(s)
 	if err != nil {
 		log.Println("Error converting timestamp to integer, returning 0. ", err)
-		i = 0
+		return Checkpoint{}
 	}
-	return secret, time.Unix(int64(i+1), 0), nil
+	// everything in that second was logged, but there are no hashes to tell which events they were
+	return Checkpoint{Last: int64(i + 1)}
 }
 
-// SaveTime persists the timestamp to parameter store after an update
-func SaveTime(t int64) (msg string, err error) {
-	_, err = paramStore.PutParameter(
+// SaveCheckpoint persists the checkpoint to parameter store, after each page and once a query is finished
+func (p *ParamStore) SaveCheckpoint(cp Checkpoint) (msg string, err error) {
+	j, _ := json.Marshal(cp)
+	_, err = p.SSM.PutParameter(
 		&ssm.PutParameterInput{
 			Description: aws.String(`lastpass lastest log timestamp`),
-			Name:        aws.String(awsDetails.TimeParameter),
+			Name:        aws.String(p.Details.TimeParameter),
 			Overwrite:   aws.Bool(true),
 			Type:        aws.String(`String`),
-			Value:       aws.String(strconv.Itoa(int(t))),
+			Value:       aws.String(string(j)),
 		},
 	)
 	if err != nil {
@@ -62,7 +133,8 @@ type AwsDetails struct {
 	TimeParameter  string `json:"time_parameter"`
 }
 
-// NewAwsDetails reads environment variables, and if missing returns sensible defaults.
+// NewAwsDetails reads environment variables, and if missing returns sensible defaults. It's only called by the Lambda,
+// importing the package doesn't read anything from the environment.
 func NewAwsDetails() AwsDetails {
 	details := AwsDetails{
 		Region:         os.Getenv(`REGION`),
@@ -0,0 +1,178 @@
+package lastpasslogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+	// the Lambda runtime doesn't always have a zoneinfo database
+	_ "time/tzdata"
+)
+
+// DefaultApi is the LastPass enterprise API endpoint
+const DefaultApi = `https://lastpass.com/enterpriseapi.php`
+
+// DefaultTimezone is the timezone of LastPass's US data center, which its API uses for timestamps. Accounts hosted
+// elsewhere, like the EU, need SetTimezone.
+const DefaultTimezone = `America/Denver`
+
+// Client calls the LastPass enterprise API. Api, HTTPClient and Now can be replaced, for example to point at a test
+// server with a fixed clock.
+type Client struct {
+	Api        string
+	HTTPClient *http.Client
+	Now        func() time.Time
+	// Location is the timezone LastPass expects and sends timestamps in
+	Location *time.Location
+
+	cid    string
+	secret string
+}
+
+// NewClient returns a Client for the account's cid and provhash secret.
+func NewClient(cid string, secret string) (*Client, error) {
+	if cid == "" {
+		return nil, errors.New("no cid (client id) set")
+	}
+	if secret == "" {
+		return nil, errors.New("no provhash (API secret) set")
+	}
+	c := &Client{
+		Api: DefaultApi,
+		HTTPClient: &http.Client{
+			Timeout: time.Second * 10,
+			Transport: &http.Transport{
+				Dial: (&net.Dialer{
+					Timeout: 5 * time.Second,
+				}).Dial,
+				TLSHandshakeTimeout: 5 * time.Second,
+			},
+		},
+		Now:    time.Now,
+		cid:    cid,
+		secret: secret,
+	}
+	if err := c.SetTimezone(DefaultTimezone); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetTimezone sets the Location from an IANA timezone name, like Europe/Dublin.
+func (c *Client) SetTimezone(name string) error {
+	tz, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("could not load the lastpass timezone %q: %v", name, err)
+	}
+	c.Location = tz
+	return nil
+}
+
+// GetLogs returns the first page of a reporting API query from start until now
+func (c *Client) GetLogs(start time.Time) (results *LastpassResponse, err error) {
+	return c.GetPage(start, c.Now(), 0)
+}
+
+// GetPage returns one page of a reporting API query, next is the cursor from the previous page or 0 for the first.
+func (c *Client) GetPage(from, to time.Time, next int) (results *LastpassResponse, err error) {
+	err = c.post(
+		&LogRequest{
+			Command: "reporting",
+			Data: map[string]string{
+				"from": from.In(c.Location).Format(lastpassFormat),
+				"to":   to.In(c.Location).Format(lastpassFormat),
+			},
+			Next: next,
+		},
+		&results,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// post sends a request to the enterprise API with the client's credentials, and decodes the response into results.
+// A response with a status other than OK is an error, not every command sets a status when it works.
+func (c *Client) post(request *LogRequest, results interface{}) error {
+	request.Id, request.Secret = c.cid, c.secret
+	postBody, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Post(c.Api, `application/json`, bytes.NewReader(postBody))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("Body.Read: " + err.Error())
+		return err
+	}
+	status := struct {
+		Status string `json:"status"`
+	}{}
+	if json.Unmarshal(b, &status) == nil && status.Status != "" && status.Status != "OK" {
+		return fmt.Errorf("lastpass %s returned status %s: %s", request.Command, status.Status, string(b))
+	}
+	err = json.Unmarshal(b, results)
+	if err != nil {
+		log.Println("json.Unmarshal: " + err.Error())
+	}
+	return err
+}
+
+// Collect reads the reporting API a page at a time, following the next cursor. It resumes the query saved in the
+// checkpoint if there is one, otherwise it starts a new one from cp.Last until now. Events in the first second that
+// were already logged are skipped. emit is called with each page's new logs and then save with the updated
+// checkpoint, so if the Lambda times out or maxPages is reached the next run carries on from the following page
+// instead of losing the rest of the window.
+func (c *Client) Collect(cp Checkpoint, maxPages int, emit func([]LastpassLog) error, save func(Checkpoint) error) (Checkpoint, error) {
+	if !cp.InProgress() {
+		cp.From, cp.To, cp.Skip = cp.Last, c.Now().Unix(), cp.Seen
+	}
+	skip := make(map[string]bool)
+	for _, h := range cp.Skip {
+		skip[h] = true
+	}
+	for page := 0; maxPages <= 0 || page < maxPages; page++ {
+		from, to := time.Unix(cp.From, 0), time.Unix(cp.To, 0)
+		resp, err := c.GetPage(from, to, cp.Next)
+		if err != nil {
+			return cp, err
+		}
+		logs := make([]LastpassLog, 0, len(resp.Data))
+		for _, l := range resp.Parse(c.Location, from, to) {
+			if l.Ts == cp.From && skip[l.Hash] {
+				continue
+			}
+			logs = append(logs, l)
+		}
+		if err = emit(logs); err != nil {
+			return cp, err
+		}
+		for _, l := range logs {
+			cp.add(l)
+		}
+		// stop on a repeated cursor too, rather than fetching the same page forever
+		if resp.Next == 0 || resp.Next == cp.Next {
+			cp.From, cp.To, cp.Next, cp.Skip = 0, 0, 0, nil
+		} else {
+			cp.Next = resp.Next
+		}
+		if err = save(cp); err != nil {
+			return cp, err
+		}
+		if !cp.InProgress() {
+			return cp, nil
+		}
+	}
+	log.Printf("stopped after %d pages, the next run will continue from cursor %d\n", maxPages, cp.Next)
+	return cp, nil
+}
@@ -0,0 +1,310 @@
+package lastpasslogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"sort"
+	"strconv"
+)
+
+// userPageSize is how many users are asked for in each getuserdata request
+const userPageSize = 100
+
+// Record types in snapshot and change logs
+const (
+	RecordUser         = "user"
+	RecordFolderMember = "shared_folder_member"
+)
+
+// UserRecord is one user from getuserdata
+type UserRecord struct {
+	Record        string   `json:"record"`
+	Ts            int64    `json:"ts,omitempty"`
+	Id            string   `json:"user_id"`
+	Username      string   `json:"username"`
+	Fullname      string   `json:"fullname,omitempty"`
+	Created       string   `json:"created,omitempty"`
+	LastPwChange  string   `json:"last_pw_change,omitempty"`
+	LastLogin     string   `json:"last_login,omitempty"`
+	Disabled      bool     `json:"disabled"`
+	NeverLoggedIn bool     `json:"never_logged_in"`
+	Admin         bool     `json:"admin"`
+	Groups        []string `json:"groups,omitempty"`
+}
+
+// FolderMemberRecord is a user's access to a shared folder from getsfdata
+type FolderMemberRecord struct {
+	Record        string `json:"record"`
+	Ts            int64  `json:"ts,omitempty"`
+	FolderId      string `json:"folder_id"`
+	FolderName    string `json:"shared_folder"`
+	Username      string `json:"username"`
+	ReadOnly      bool   `json:"read_only"`
+	CanShare      bool   `json:"can_share"`
+	CanAdminister bool   `json:"can_administer"`
+}
+
+// flag decodes the API's booleans, which come as true/false, 0/1 or "0"/"1" depending on the command
+type flag bool
+
+func (f *flag) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		s = string(b)
+	}
+	*f = s == "1" || s == "true"
+	return nil
+}
+
+type origUser struct {
+	Username      string   `json:"username"`
+	Fullname      string   `json:"fullname"`
+	Created       string   `json:"created"`
+	LastPwChange  string   `json:"last_pw_change"`
+	LastLogin     string   `json:"last_login"`
+	Disabled      flag     `json:"disabled"`
+	NeverLoggedIn flag     `json:"neverloggedin"`
+	Admin         flag     `json:"admin"`
+	Groups        []string `json:"groups"`
+}
+
+type userDataResponse struct {
+	Users map[string]origUser `json:"Users"`
+	Total int                 `json:"total"`
+}
+
+type origFolder struct {
+	Name  string `json:"sharedfoldername"`
+	Users []struct {
+		Username      string `json:"username"`
+		ReadOnly      flag   `json:"readonly"`
+		Give          flag   `json:"give"`
+		CanAdminister flag   `json:"can_administer"`
+	} `json:"users"`
+}
+
+// GetUsers pages through getuserdata for every user in the enterprise
+func (c *Client) GetUsers() ([]UserRecord, error) {
+	users := make([]UserRecord, 0)
+	for page := 0; ; page++ {
+		resp := userDataResponse{}
+		err := c.post(&LogRequest{
+			Command: "getuserdata",
+			Data:    map[string]string{"pagesize": strconv.Itoa(userPageSize), "pageindex": strconv.Itoa(page)},
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		for id, u := range resp.Users {
+			users = append(users, UserRecord{
+				Record:        RecordUser,
+				Id:            id,
+				Username:      u.Username,
+				Fullname:      u.Fullname,
+				Created:       u.Created,
+				LastPwChange:  u.LastPwChange,
+				LastLogin:     u.LastLogin,
+				Disabled:      bool(u.Disabled),
+				NeverLoggedIn: bool(u.NeverLoggedIn),
+				Admin:         bool(u.Admin),
+				Groups:        u.Groups,
+			})
+		}
+		// total isn't always sent, without it only a short page means there are no more
+		if len(resp.Users) < userPageSize || (resp.Total > 0 && len(users) >= resp.Total) {
+			break
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// GetFolderMembers returns a record for each user of each shared folder from getsfdata
+func (c *Client) GetFolderMembers() ([]FolderMemberRecord, error) {
+	folders := make(map[string]origFolder)
+	err := c.post(&LogRequest{Command: "getsfdata", Data: map[string]string{}}, &folders)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]FolderMemberRecord, 0)
+	for id, f := range folders {
+		for _, u := range f.Users {
+			members = append(members, FolderMemberRecord{
+				Record:        RecordFolderMember,
+				FolderId:      id,
+				FolderName:    f.Name,
+				Username:      u.Username,
+				ReadOnly:      bool(u.ReadOnly),
+				CanShare:      bool(u.Give),
+				CanAdminister: bool(u.CanAdminister),
+			})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].key() < members[j].key() })
+	return members, nil
+}
+
+func (m FolderMemberRecord) key() string {
+	return m.FolderId + "/" + m.Username
+}
+
+// Snapshot is the enterprise's users and shared folder memberships at one time, keyed by username and by
+// folder id/username.
+type Snapshot struct {
+	Ts      int64                         `json:"ts"`
+	Users   map[string]UserRecord         `json:"users"`
+	Members map[string]FolderMemberRecord `json:"members"`
+}
+
+// NewSnapshot builds a Snapshot, the records' Ts is left empty so they can be compared.
+func NewSnapshot(ts int64, users []UserRecord, members []FolderMemberRecord) Snapshot {
+	s := Snapshot{Ts: ts, Users: make(map[string]UserRecord), Members: make(map[string]FolderMemberRecord)}
+	for _, u := range users {
+		u.Ts = 0
+		s.Users[u.Username] = u
+	}
+	for _, m := range members {
+		m.Ts = 0
+		s.Members[m.key()] = m
+	}
+	return s
+}
+
+// Records returns every record in the snapshot with Ts set, users first, for logging the whole inventory.
+func (s Snapshot) Records() []interface{} {
+	records := make([]interface{}, 0, len(s.Users)+len(s.Members))
+	for _, k := range sortedKeys(s.Users) {
+		u := s.Users[k]
+		u.Ts = s.Ts
+		records = append(records, u)
+	}
+	for _, k := range sortedKeys(s.Members) {
+		m := s.Members[k]
+		m.Ts = s.Ts
+		records = append(records, m)
+	}
+	return records
+}
+
+// Change is a difference between two snapshots: added, removed or changed. Current is the record now and Previous
+// what it was, so a removed record only has Previous.
+type Change struct {
+	Ts       int64       `json:"ts"`
+	Change   string      `json:"change"`
+	Record   string      `json:"record"`
+	Key      string      `json:"key"`
+	Current  interface{} `json:"current,omitempty"`
+	Previous interface{} `json:"previous,omitempty"`
+}
+
+// Diff lists what changed since prev. A user's last login isn't counted as a change, it would make every user change
+// on every run.
+func (s Snapshot) Diff(prev Snapshot) []Change {
+	changes := make([]Change, 0)
+	for _, k := range sortedKeys(s.Users) {
+		u := s.Users[k]
+		old, ok := prev.Users[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Ts: s.Ts, Change: "added", Record: RecordUser, Key: k, Current: u})
+		case !sameUser(old, u):
+			changes = append(changes, Change{Ts: s.Ts, Change: "changed", Record: RecordUser, Key: k, Current: u, Previous: old})
+		}
+	}
+	for _, k := range sortedKeys(prev.Users) {
+		if _, ok := s.Users[k]; !ok {
+			changes = append(changes, Change{Ts: s.Ts, Change: "removed", Record: RecordUser, Key: k, Previous: prev.Users[k]})
+		}
+	}
+	for _, k := range sortedKeys(s.Members) {
+		m := s.Members[k]
+		old, ok := prev.Members[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Ts: s.Ts, Change: "added", Record: RecordFolderMember, Key: k, Current: m})
+		case old != m:
+			changes = append(changes, Change{Ts: s.Ts, Change: "changed", Record: RecordFolderMember, Key: k, Current: m, Previous: old})
+		}
+	}
+	for _, k := range sortedKeys(prev.Members) {
+		if _, ok := s.Members[k]; !ok {
+			changes = append(changes, Change{Ts: s.Ts, Change: "removed", Record: RecordFolderMember, Key: k, Previous: prev.Members[k]})
+		}
+	}
+	return changes
+}
+
+func sameUser(a, b UserRecord) bool {
+	a.LastLogin, b.LastLogin = "", ""
+	a.NeverLoggedIn, b.NeverLoggedIn = false, false
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	return bytes.Equal(aj, bj)
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := make([]string, 0)
+	switch v := m.(type) {
+	case map[string]UserRecord:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]FolderMemberRecord:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SnapshotStore keeps the last snapshot in an S3 object, it's too big for a parameter.
+type SnapshotStore struct {
+	S3     s3iface.S3API
+	Bucket string
+	Key    string
+}
+
+// Load returns the saved snapshot, or nil if there isn't one yet
+func (s *SnapshotStore) Load() (*Snapshot, error) {
+	out, err := s.S3.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(s.Key)})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{}
+	if err = json.Unmarshal(b, snap); err != nil {
+		return nil, fmt.Errorf("could not decode snapshot s3://%s/%s: %v", s.Bucket, s.Key, err)
+	}
+	return snap, nil
+}
+
+// Save replaces the saved snapshot
+func (s *SnapshotStore) Save(snap Snapshot) error {
+	j, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	_, err = s.S3.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(s.Bucket),
+		Key:                  aws.String(s.Key),
+		Body:                 bytes.NewReader(j),
+		ServerSideEncryption: aws.String("AES256"),
+	})
+	return err
+}
@@ -0,0 +1,159 @@
+package lastpasslogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+const (
+	rawUserData = `{"Users":{"101":{"username":"alice@example.com","fullname":"Alice","created":"2020-01-01 10:00:00","last_login":"2023-05-01 10:00:00","disabled":false,"neverloggedin":false,"admin":true,"groups":["Admins"]},"102":{"username":"bob@example.com","disabled":"1","admin":0}},"total":2,"count":2}`
+	rawSfData   = `{"5001":{"sharedfoldername":"Shared-Finance","score":90,"users":[{"username":"alice@example.com","readonly":"0","give":"1","can_administer":"1"},{"username":"bob@example.com","readonly":"1","give":"0","can_administer":"0"}]}}`
+)
+
+func TestGetInventory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := LogRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Command {
+		case "getuserdata":
+			_, _ = w.Write([]byte(rawUserData))
+		case "getsfdata":
+			_, _ = w.Write([]byte(rawSfData))
+		default:
+			_, _ = w.Write([]byte(`{"status":"FAIL","error":["unknown command"]}`))
+		}
+	}))
+	defer srv.Close()
+	c := testClient(t, srv)
+
+	users, err := c.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Username != "alice@example.com" || !users[0].Admin || users[0].Groups[0] != "Admins" ||
+		!users[1].Disabled || users[1].Admin || users[1].Id != "102" {
+		t.Errorf("unexpected users %+v", users)
+	}
+	members, err := c.GetFolderMembers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].FolderName != "Shared-Finance" || !members[0].CanShare || !members[0].CanAdminister ||
+		!members[1].ReadOnly || members[1].CanShare {
+		t.Errorf("unexpected members %+v", members)
+	}
+
+	if err = c.post(&LogRequest{Command: "getfoo"}, &map[string]interface{}{}); err == nil {
+		t.Error("expected an error for a FAIL status")
+	}
+}
+
+func TestGetUsersWithoutTotal(t *testing.T) {
+	const count = 250
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := LogRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		page, _ := strconv.Atoi(req.Data["pageindex"])
+		users := make(map[string]map[string]string)
+		for i := page * userPageSize; i < count && i < (page+1)*userPageSize; i++ {
+			users[strconv.Itoa(i)] = map[string]string{"username": fmt.Sprintf("user%03d@example.com", i)}
+		}
+		// no total
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"Users": users})
+	}))
+	defer srv.Close()
+
+	users, err := testClient(t, srv).GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != count {
+		t.Errorf("expected all %d users, got %d", count, len(users))
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	users := []UserRecord{
+		{Record: RecordUser, Username: "alice@example.com", Admin: true, LastLogin: "2023-05-01 10:00:00"},
+		{Record: RecordUser, Username: "bob@example.com"},
+	}
+	members := []FolderMemberRecord{
+		{Record: RecordFolderMember, FolderId: "5001", Username: "alice@example.com", CanShare: true},
+		{Record: RecordFolderMember, FolderId: "5001", Username: "bob@example.com", ReadOnly: true},
+	}
+	prev := NewSnapshot(1, users, members)
+	if changes := NewSnapshot(2, users, members).Diff(prev); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+	if records := prev.Records(); len(records) != 4 || records[0].(UserRecord).Ts != 1 {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	users = []UserRecord{
+		{Record: RecordUser, Username: "alice@example.com", Admin: true, LastLogin: "2023-05-02 10:00:00"},
+		{Record: RecordUser, Username: "carol@example.com"},
+	}
+	members = []FolderMemberRecord{
+		{Record: RecordFolderMember, FolderId: "5001", Username: "alice@example.com", CanShare: true},
+		{Record: RecordFolderMember, FolderId: "5001", Username: "bob@example.com", ReadOnly: false, CanShare: true},
+	}
+	got := ""
+	for _, c := range NewSnapshot(3, users, members).Diff(prev) {
+		got += c.Change + " " + c.Key + ", "
+		if c.Ts != 3 {
+			t.Errorf("change should have the snapshot's time, got %d", c.Ts)
+		}
+		if c.Change == "changed" && c.Previous.(FolderMemberRecord).ReadOnly != true {
+			t.Errorf("changed record should have the previous permissions, got %+v", c.Previous)
+		}
+	}
+	want := "added carol@example.com, removed bob@example.com, changed 5001/bob@example.com, "
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+// fakeS3 holds objects in memory
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	b, ok := f.objects[aws.StringValue(in.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	b, _ := ioutil.ReadAll(in.Body)
+	f.objects[aws.StringValue(in.Key)] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestSnapshotStore(t *testing.T) {
+	store := &SnapshotStore{S3: &fakeS3{objects: make(map[string][]byte)}, Bucket: "b", Key: "lastpass/snapshot.json"}
+	snap, err := store.Load()
+	if err != nil || snap != nil {
+		t.Fatalf("expected no snapshot yet, got %+v, %v", snap, err)
+	}
+	saved := NewSnapshot(1, []UserRecord{{Record: RecordUser, Username: "alice@example.com"}}, nil)
+	if err = store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	if snap, err = store.Load(); err != nil || len(snap.Users) != 1 || len(snap.Diff(saved)) != 0 {
+		t.Fatalf("expected the saved snapshot back, got %+v, %v", snap, err)
+	}
+}
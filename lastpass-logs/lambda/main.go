@@ -2,32 +2,151 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	lastpasslogs "github.com/blockpane/logsuck/lastpass-logs"
 	"log"
+	"os"
+	"strconv"
+	"time"
 )
 
+// defaultMaxPages is how many pages of results one run fetches unless MAX_PAGES is set, the rest are picked up by
+// the next run.
+const defaultMaxPages = 20
+
+// MODE selects what is collected: by default the reporting API's events since the last run, inventory logs every user
+// and shared folder membership, and changes only logs what was added, removed or changed since the last snapshot.
+// Both snapshot modes save the snapshot to s3://$SNAPSHOT_BUCKET/$SNAPSHOT_KEY when SNAPSHOT_BUCKET is set, changes
+// requires it.
 func main() {
-	lambda.Start(handler)
+	switch os.Getenv("MODE") {
+	case "inventory":
+		lambda.Start(func() (string, error) { return snapshot(false) })
+	case "changes":
+		lambda.Start(func() (string, error) { return snapshot(true) })
+	default:
+		lambda.Start(handler)
+	}
+}
+
+// setup reads the secret and checkpoint from SSM and builds the API client for CID. LASTPASS_TIMEZONE overrides the
+// timezone the API's timestamps are read in, for accounts outside the US data center.
+func setup() (store *lastpasslogs.ParamStore, client *lastpasslogs.Client, cp lastpasslogs.Checkpoint, msg string, err error) {
+	store, err = lastpasslogs.NewParamStore(lastpasslogs.NewAwsDetails())
+	if err != nil {
+		return nil, nil, cp, "problem creating AWS session", err
+	}
+	secret, cp, err := store.GetSSMValues()
+	if err != nil {
+		return nil, nil, cp, "problem getting SSM parameters", err
+	}
+	client, err = lastpasslogs.NewClient(os.Getenv("CID"), secret)
+	if err != nil {
+		return nil, nil, cp, "problem creating lastpass client", err
+	}
+	if tz := os.Getenv("LASTPASS_TIMEZONE"); tz != "" {
+		if err = client.SetTimezone(tz); err != nil {
+			return nil, nil, cp, "LASTPASS_TIMEZONE is not a valid timezone", err
+		}
+	}
+	return
 }
 
 func handler() (msg string, err error) {
-	secret, last, err := lastpasslogs.GetSSMValues()
-	var save bool
-	latest := last.Unix()
+	store, client, cp, msg, err := setup()
 	if err != nil {
-		return "problem getting SSM parameters", err
+		return
+	}
+	maxPages := defaultMaxPages
+	if s := os.Getenv("MAX_PAGES"); s != "" {
+		if maxPages, err = strconv.Atoi(s); err != nil {
+			return "MAX_PAGES is not a number", err
+		}
 	}
-	newLogs, err := lastpasslogs.GetLogs(secret, last)
+	_, err = client.Collect(cp, maxPages, printLogs, func(cp lastpasslogs.Checkpoint) error {
+		msg, err := store.SaveCheckpoint(cp)
+		if err != nil {
+			log.Println(msg)
+		}
+		return err
+	})
 	if err != nil {
 		return "problem getting logs from lastpass", err
 	}
-	for _, l := range newLogs.Parse() {
-		if l.Ts > latest {
-			save = true
-			latest = l.Ts
+	return
+}
+
+// snapshot fetches the users and shared folders, and logs either all of them or the changes since the saved snapshot.
+func snapshot(changes bool) (msg string, err error) {
+	_, client, _, msg, err := setup()
+	if err != nil {
+		return
+	}
+	var store *lastpasslogs.SnapshotStore
+	if bucket := os.Getenv("SNAPSHOT_BUCKET"); bucket != "" {
+		key := os.Getenv("SNAPSHOT_KEY")
+		if key == "" {
+			key = "lastpass/snapshot.json"
+		}
+		sess, err := session.NewSession()
+		if err != nil {
+			return "problem creating AWS session", err
+		}
+		store = &lastpasslogs.SnapshotStore{S3: s3.New(sess), Bucket: bucket, Key: key}
+	} else if changes {
+		return "SNAPSHOT_BUCKET is required for changes", errors.New("no SNAPSHOT_BUCKET set")
+	}
+
+	users, err := client.GetUsers()
+	if err != nil {
+		return "problem getting users from lastpass", err
+	}
+	members, err := client.GetFolderMembers()
+	if err != nil {
+		return "problem getting shared folders from lastpass", err
+	}
+	snap := lastpasslogs.NewSnapshot(time.Now().Unix(), users, members)
+
+	if changes {
+		prev, err := store.Load()
+		if err != nil {
+			return "problem loading the last snapshot", err
+		}
+		if prev == nil {
+			log.Println("no previous snapshot, every record is logged as added")
+			prev = &lastpasslogs.Snapshot{}
+		}
+		for _, c := range snap.Diff(*prev) {
+			printJson(c)
+		}
+	} else {
+		for _, r := range snap.Records() {
+			printJson(r)
+		}
+	}
+	if store != nil {
+		if err = store.Save(snap); err != nil {
+			return "problem saving the snapshot", err
 		}
+	}
+	return
+}
+
+func printJson(v interface{}) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		log.Println("problem marshalling record", err)
+		return
+	}
+	fmt.Println(string(j))
+}
+
+func printLogs(logs []lastpasslogs.LastpassLog) error {
+	for _, l := range logs {
 		j, err := json.Marshal(l)
 		if err != nil {
 			log.Println("problem unmarshalling log result", err)
@@ -35,8 +154,5 @@ func handler() (msg string, err error) {
 		}
 		fmt.Println(string(j))
 	}
-	if save {
-		msg, err = lastpasslogs.SaveTime(latest)
-	}
-	return
+	return nil
 }
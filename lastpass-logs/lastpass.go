@@ -1,13 +1,13 @@
 package lastpasslogs
 
 import (
-	"bytes"
-	"encoding/json"
-	"io/ioutil"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/blockpane/logsuck/internal/ipaddr"
 	"log"
-	"net"
-	"net/http"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,8 +24,28 @@ type LastpassLog struct {
 	Ts        int64  `json:"ts"`
 	Username  string `json:"username"`
 	SrcIp     string `json:"src_ip"`
+	IpVersion int    `json:"src_ip_version,omitempty"`
 	EventName string `json:"event_name"`
 	Detail    string `json:"description"`
+
+	// Parsed from Detail depending on EventName, see actionParsers
+	TargetUser   string `json:"target_user,omitempty"`
+	SharedFolder string `json:"shared_folder,omitempty"`
+	Site         string `json:"site,omitempty"`
+	Url          string `json:"url,omitempty"`
+	Policy       string `json:"policy,omitempty"`
+	OldValue     string `json:"old_value,omitempty"`
+	NewValue     string `json:"new_value,omitempty"`
+
+	// TimeUncertain is set when the local timestamp couldn't be pinned to one instant: it happened twice when clocks
+	// went back and the query window didn't decide which, it was skipped when clocks went forward, or it didn't
+	// parse. TsAlternate is the other candidate for a repeated time.
+	TimeUncertain bool  `json:"time_uncertain,omitempty"`
+	TsAlternate   int64 `json:"ts_alternate,omitempty"`
+
+	// Hash identifies the event across queries, LastPass's own keys (Event1, Event2...) are only its position in
+	// the response
+	Hash string `json:"hash"`
 }
 
 type LastpassResponse struct {
@@ -34,14 +54,31 @@ type LastpassResponse struct {
 	Data   map[string]OrigLastpassLog `json:"data"`
 }
 
-// Parse splits logs into individual rows suitable for ingest
-func (r LastpassResponse) Parse() (logs []LastpassLog) {
-	for _, log := range r.Data {
-		logs = append(logs, log.ToLog())
+// Parse splits logs into individual rows suitable for ingest, sorted by timestamp and then the event's key so the
+// order is the same every time. from and to are the query's window, see ToLog.
+func (r LastpassResponse) Parse(loc *time.Location, from, to time.Time) (logs []LastpassLog) {
+	keys := make([]string, 0, len(r.Data))
+	for k := range r.Data {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keyLess(keys[i], keys[j]) })
+	for _, k := range keys {
+		logs = append(logs, r.Data[k].ToLog(loc, from, to))
 	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].Ts < logs[j].Ts })
 	return
 }
 
+// keyLess orders keys like Event2 before Event10, anything else falls back to comparing the strings.
+func keyLess(a, b string) bool {
+	na, errA := strconv.Atoi(strings.TrimPrefix(a, "Event"))
+	nb, errB := strconv.Atoi(strings.TrimPrefix(b, "Event"))
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return na < nb
+}
+
 // OrigLastpassLog has different JSON names -- lastpass sends Studly Snake variables, we want plain snakes, this helps
 type OrigLastpassLog struct {
 	Timestamp string `json:"Time"`
@@ -51,71 +88,71 @@ type OrigLastpassLog struct {
 	Data      string `json:"Data"`
 }
 
-// ToLog converts a OrigLastpassLog to a LastpassLog
-func (o OrigLastpassLog) ToLog() LastpassLog {
-	t, err := time.ParseInLocation(lastpassFormat, o.Timestamp, lastpassTz)
+// ToLog converts a OrigLastpassLog to a LastpassLog, reading its time in LastPass's timezone. The timestamps have no
+// offset, so the hour repeated when clocks go back could be either of two instants, the one inside the query's
+// window from..to is used. Zero times leave the window open.
+func (o OrigLastpassLog) ToLog(loc *time.Location, from, to time.Time) LastpassLog {
+	ts, alt, uncertain, err := localToUnix(o.Timestamp, loc, from, to)
 	if err != nil {
 		log.Println("Warning: couldn't parsing timestamp, using current time instead:", err)
-		t = time.Now()
+		ts, uncertain = time.Now().Unix(), true
 	}
-	return LastpassLog{
-		Ts:        t.Unix(),
-		Username:  o.Username,
-		SrcIp:     o.IpAddress,
-		EventName: o.Action,
-		Detail:    o.Data,
+	ip, version := ipaddr.Normalize(o.IpAddress)
+	l := LastpassLog{
+		Ts:            ts,
+		TsAlternate:   alt,
+		TimeUncertain: uncertain,
+		Username:      o.Username,
+		SrcIp:         ip,
+		IpVersion:     version,
+		EventName:     o.Action,
+		Detail:        o.Data,
+		Hash:          o.hash(),
 	}
+	l.parseData(o.Action, o.Data)
+	return l
 }
 
-// GetLogs returns the result of a reporting API query
-func GetLogs(secret string, start time.Time) (results *LastpassResponse, err error) {
-	from := start.In(lastpassTz).Format(lastpassFormat)
-	to := time.Now().In(lastpassTz).Format(lastpassFormat)
-	cid := getCid()
-	postBody, err := json.Marshal(
-		&LogRequest{
-			Id:      cid,
-			Secret:  secret,
-			Command: "reporting",
-			Data:    map[string]string{"from": from, "to": to},
-		},
-	)
+// localToUnix reads a timestamp in loc. When it names two instants and the window doesn't rule one out, the earlier is
+// returned with the later as alt. A time skipped when clocks went forward is read with the offset from before the
+// change, and is uncertain too.
+func localToUnix(s string, loc *time.Location, from, to time.Time) (ts int64, alt int64, uncertain bool, err error) {
+	wall, err := time.Parse(lastpassFormat, s)
 	if err != nil {
-		return
+		return 0, 0, false, err
 	}
-	var tr = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 5 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 5 * time.Second,
+	// the offsets in use either side of the wall time, a transition can't be more than a day out
+	candidates := make([]int64, 0, 2)
+	for _, d := range []time.Duration{-24 * time.Hour, 24 * time.Hour} {
+		_, offset := wall.Add(d).In(loc).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second)
+		if t.In(loc).Format(lastpassFormat) != s || (len(candidates) == 1 && candidates[0] == t.Unix()) {
+			continue
+		}
+		candidates = append(candidates, t.Unix())
 	}
-	var client = &http.Client{
-		Timeout:   time.Second * 10,
-		Transport: tr,
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+	switch len(candidates) {
+	case 0:
+		_, offset := wall.Add(-24 * time.Hour).In(loc).Zone()
+		return wall.Unix() - int64(offset), 0, true, nil
+	case 1:
+		return candidates[0], 0, false, nil
 	}
-	resp, err := client.Post(lastpassApi, `application/json`, bytes.NewReader(postBody))
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("Body.Read: " + err.Error())
-		return
+	inWindow := make([]int64, 0, 2)
+	for _, c := range candidates {
+		if (from.IsZero() || c >= from.Unix()) && (to.IsZero() || c <= to.Unix()) {
+			inWindow = append(inWindow, c)
+		}
 	}
-	err = json.Unmarshal(b, &results)
-	if err != nil {
-		log.Println("json.Unmarshal: " + err.Error())
-		return
+	if len(inWindow) == 1 {
+		return inWindow[0], 0, false, nil
 	}
-	return
+	return candidates[0], candidates[1], true, nil
 }
 
-// getCid grabs the cid from ENV
-func getCid() (cid string) {
-	cid = os.Getenv(`CID`)
-	if cid == "" {
-		log.Fatal("No CID env var (client id) set.")
-	}
-	return
+// hash is a digest of every field, events that are identical down to the second can't be told apart anyway
+func (o OrigLastpassLog) hash() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{o.Timestamp, o.Username, o.IpAddress, o.Action, o.Data}, "\x00")))
+	return hex.EncodeToString(sum[:16])
 }
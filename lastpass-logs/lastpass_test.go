@@ -0,0 +1,237 @@
+package lastpasslogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeReporting serves pages of one event each, page n's cursor is n+1 until the last page.
+func fakeReporting(t *testing.T, pages int) (*httptest.Server, *[]LogRequest) {
+	requests := make([]LogRequest, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := LogRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		requests = append(requests, req)
+		resp := LastpassResponse{Status: "OK", Data: map[string]OrigLastpassLog{
+			fmt.Sprintf("Event%d", req.Next): {
+				Timestamp: fmt.Sprintf("2023-05-01 10:00:%02d", req.Next),
+				Username:  "user@example.com",
+				IpAddress: "192.0.2.1",
+				Action:    "Log in",
+			},
+		}}
+		if req.Next < pages-1 {
+			resp.Next = req.Next + 1
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	return srv, &requests
+}
+
+// testClient returns a Client for the test server
+func testClient(t *testing.T, srv *httptest.Server) *Client {
+	c, err := NewClient("12345", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Api = srv.URL
+	return c
+}
+
+func TestCollect(t *testing.T) {
+	srv, requests := fakeReporting(t, 3)
+	defer srv.Close()
+	c := testClient(t, srv)
+
+	var emitted []LastpassLog
+	var saved []Checkpoint
+	emit := func(logs []LastpassLog) error {
+		emitted = append(emitted, logs...)
+		return nil
+	}
+	save := func(cp Checkpoint) error {
+		saved = append(saved, cp)
+		return nil
+	}
+
+	cp, err := c.Collect(Checkpoint{Last: 1682900000}, 2, emit, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 2 || len(saved) != 2 || !cp.InProgress() || cp.Next != 2 {
+		t.Fatalf("expected to stop at the page cap with cursor 2, got %d logs, %d saves and %+v", len(emitted), len(saved), cp)
+	}
+	from, to := (*requests)[0].Data["from"], (*requests)[0].Data["to"]
+	if (*requests)[1].Data["from"] != from || (*requests)[1].Data["to"] != to || (*requests)[1].Next != 1 {
+		t.Errorf("second page should use the same window with the cursor, got %+v", (*requests)[1])
+	}
+
+	// the next run resumes the saved query
+	cp, err = c.Collect(cp, 2, emit, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 3 || cp.InProgress() || cp.From != 0 {
+		t.Fatalf("expected the last page and a finished query, got %d logs and %+v", len(emitted), cp)
+	}
+	if (*requests)[2].Data["from"] != from || (*requests)[2].Next != 2 {
+		t.Errorf("resumed query should keep the window, got %+v", (*requests)[2])
+	}
+	if cp.Last != emitted[2].Ts {
+		t.Errorf("expected the checkpoint at the newest event %d, got %d", emitted[2].Ts, cp.Last)
+	}
+}
+
+func TestCollectSameSecond(t *testing.T) {
+	data := map[string]OrigLastpassLog{
+		"Event1": {Timestamp: "2023-05-01 10:00:00", Username: "a@example.com", Action: "Log in"},
+		"Event2": {Timestamp: "2023-05-01 10:00:00", Username: "b@example.com", Action: "Log in"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(LastpassResponse{Status: "OK", Data: data})
+	}))
+	defer srv.Close()
+	c := testClient(t, srv)
+
+	var emitted []LastpassLog
+	emit := func(logs []LastpassLog) error {
+		emitted = append(emitted, logs...)
+		return nil
+	}
+	save := func(Checkpoint) error { return nil }
+	cp, err := c.Collect(Checkpoint{}, 1, emit, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 2 || len(cp.Seen) != 2 {
+		t.Fatalf("expected both events, got %d and %+v", len(emitted), cp)
+	}
+
+	// a third event turns up later in the same second, only it is new
+	data["Event3"] = OrigLastpassLog{Timestamp: "2023-05-01 10:00:00", Username: "c@example.com", Action: "Log in"}
+	emitted = nil
+	cp, err = c.Collect(cp, 1, emit, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 1 || emitted[0].Username != "c@example.com" || len(cp.Seen) != 3 {
+		t.Fatalf("expected only the new event, got %+v and %+v", emitted, cp)
+	}
+}
+
+func TestCheckpointSize(t *testing.T) {
+	// a busy second with both Seen and Skip full still fits in a standard SSM parameter
+	cp := Checkpoint{Last: 1682935200, From: 1682935200, To: 1682938800, Next: 100000}
+	for i := 0; i < 500; i++ {
+		cp.add(LastpassLog{Ts: cp.Last, Hash: fmt.Sprintf("%032x", i)})
+	}
+	cp.Skip = cp.Seen
+	if len(cp.Seen) != maxSeen {
+		t.Fatalf("expected %d hashes, got %d", maxSeen, len(cp.Seen))
+	}
+	j, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(j) > 4096 {
+		t.Fatalf("checkpoint is %d bytes", len(j))
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	r := LastpassResponse{Data: map[string]OrigLastpassLog{
+		"Event10": {Timestamp: "2023-05-01 10:00:01", Username: "d"},
+		"Event2":  {Timestamp: "2023-05-01 10:00:01", Username: "c"},
+		"Event3":  {Timestamp: "2023-05-01 10:00:00", Username: "b"},
+		"Event1":  {Timestamp: "2023-05-01 10:00:00", Username: "a"},
+	}}
+	for i := 0; i < 10; i++ {
+		logs := r.Parse(time.UTC, time.Time{}, time.Time{})
+		order := ""
+		for _, l := range logs {
+			order += l.Username
+		}
+		if order != "abcd" {
+			t.Fatalf("expected events in the order abcd, got %s", order)
+		}
+	}
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	for s, want := range map[string]Checkpoint{
+		"1682900000": {Last: 1682900001},
+		`{"last":5,"seen":["x"],"from":1,"to":9,"next":3}`: {Last: 5, Seen: []string{"x"}, From: 1, To: 9, Next: 3},
+		"garbage": {},
+	} {
+		if cp := parseCheckpoint(s); !reflect.DeepEqual(cp, want) {
+			t.Errorf("%s: got %+v", s, cp)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := NewClient("", "secret"); err == nil {
+		t.Error("expected an error without a cid")
+	}
+	if _, err := NewClient("12345", ""); err == nil {
+		t.Error("expected an error without a secret")
+	}
+}
+
+func TestSetTimezone(t *testing.T) {
+	c, err := NewClient("12345", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Location.String() != DefaultTimezone {
+		t.Errorf("expected %s by default, got %s", DefaultTimezone, c.Location)
+	}
+	if err = c.SetTimezone("Europe/Dublin"); err != nil || c.Location.String() != "Europe/Dublin" {
+		t.Errorf("could not set Europe/Dublin: %v", err)
+	}
+	if err = c.SetTimezone("Mars/Olympus_Mons"); err == nil {
+		t.Error("expected an error for an unknown timezone")
+	}
+}
+
+func TestToLogDST(t *testing.T) {
+	c, err := NewClient("12345", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 01:30 on 2021-11-07 happened at 07:30Z in MDT, then again at 08:30Z in MST
+	mdt := time.Date(2021, 11, 7, 7, 30, 0, 0, time.UTC)
+	mst := time.Date(2021, 11, 7, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name, ts  string
+		from, to  time.Time
+		want, alt time.Time
+		uncertain bool
+	}{
+		{"normal", "2021-11-06 12:00:00", time.Time{}, time.Time{}, time.Date(2021, 11, 6, 18, 0, 0, 0, time.UTC), time.Time{}, false},
+		{"repeated, open window", "2021-11-07 01:30:00", time.Time{}, time.Time{}, mdt, mst, true},
+		{"repeated, window has both", "2021-11-07 01:30:00", mdt.Add(-time.Hour), mst.Add(time.Hour), mdt, mst, true},
+		{"repeated, window ends before MST", "2021-11-07 01:30:00", mdt.Add(-time.Hour), mdt.Add(time.Minute), mdt, time.Time{}, false},
+		{"repeated, window starts after MDT", "2021-11-07 01:30:00", mst.Add(-time.Minute), mst.Add(time.Hour), mst, time.Time{}, false},
+		{"skipped", "2021-03-14 02:30:00", time.Time{}, time.Time{}, time.Date(2021, 3, 14, 9, 30, 0, 0, time.UTC), time.Time{}, true},
+	}
+	for _, tt := range tests {
+		l := OrigLastpassLog{Timestamp: tt.ts, Action: "Login"}.ToLog(c.Location, tt.from, tt.to)
+		var alt int64
+		if !tt.alt.IsZero() {
+			alt = tt.alt.Unix()
+		}
+		if l.Ts != tt.want.Unix() || l.TsAlternate != alt || l.TimeUncertain != tt.uncertain {
+			t.Errorf("%s: got ts %d alternate %d uncertain %v, want %d %d %v", tt.name, l.Ts, l.TsAlternate,
+				l.TimeUncertain, tt.want.Unix(), alt, tt.uncertain)
+		}
+	}
+}
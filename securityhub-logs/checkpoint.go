@@ -0,0 +1,101 @@
+package securityhublogs
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"time"
+)
+
+// maxPositionIds caps the ids kept in a Position, finding ids are ARNs so this keeps it inside a standard SSM
+// parameter. Past that, findings with the newest UpdatedAt can be printed twice, but none are lost.
+const maxPositionIds = 20
+
+// Position is how far a Poller got: the newest UpdatedAt collected and the ids of the findings with that UpdatedAt.
+// The next poll's filter includes UpdatedAt itself, so findings updated at the same instant aren't missed, and skips
+// the ones in Ids.
+type Position struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	Ids       []string  `json:"ids,omitempty"`
+}
+
+// add records a collected finding, moving UpdatedAt forward if it is newer
+func (p *Position) add(updated time.Time, id string) {
+	switch {
+	case updated.After(p.UpdatedAt):
+		p.UpdatedAt = updated
+		p.Ids = []string{id}
+	case updated.Equal(p.UpdatedAt):
+		for _, i := range p.Ids {
+			if i == id {
+				return
+			}
+		}
+		if len(p.Ids) < maxPositionIds {
+			p.Ids = append(p.Ids, id)
+		}
+	}
+}
+
+// collected reports if the finding was already collected at this position
+func (p Position) collected(updated time.Time, id string) bool {
+	if !updated.Equal(p.UpdatedAt) {
+		return false
+	}
+	for _, i := range p.Ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Checkpoint keeps the Position of the newest finding collected by a Poller in an SSM parameter.
+type Checkpoint struct {
+	SSM  ssmiface.SSMAPI
+	Name string
+}
+
+// NewCheckpoint returns a Checkpoint stored in the named parameter.
+func NewCheckpoint(svc ssmiface.SSMAPI, name string) *Checkpoint {
+	return &Checkpoint{SSM: svc, Name: name}
+}
+
+// Load returns the saved position, or the zero Position if the parameter doesn't exist yet. A plain timestamp saved
+// by an older version is a Position without any ids.
+func (c *Checkpoint) Load() (Position, error) {
+	pos := Position{}
+	out, err := c.SSM.GetParameter(&ssm.GetParameterInput{Name: aws.String(c.Name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return pos, nil
+		}
+		return pos, err
+	}
+	v := ""
+	if out.Parameter != nil {
+		v = aws.StringValue(out.Parameter.Value)
+	}
+	if v != "" {
+		err = json.Unmarshal([]byte(v), &pos)
+	}
+	return pos, err
+}
+
+// Save persists the position.
+func (c *Checkpoint) Save(pos Position) error {
+	pos.UpdatedAt = pos.UpdatedAt.UTC()
+	j, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	_, err = c.SSM.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(c.Name),
+		Overwrite: aws.Bool(true),
+		Type:      aws.String("String"),
+		Value:     aws.String(string(j)),
+	})
+	return err
+}
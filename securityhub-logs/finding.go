@@ -0,0 +1,190 @@
+package securityhublogs
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"strings"
+)
+
+// Finding is the part of the AWS Security Finding Format (ASFF) that gets logged. It's decoded with its own json
+// tags rather than into securityhub.AwsSecurityFinding so that unusual resource details from a third party product
+// can't stop the rest of the finding from being read.
+type Finding struct {
+	Id             string   `json:"Id"`
+	ProductArn     string   `json:"ProductArn"`
+	ProductName    string   `json:"ProductName"`
+	CompanyName    string   `json:"CompanyName"`
+	GeneratorId    string   `json:"GeneratorId"`
+	AwsAccountId   string   `json:"AwsAccountId"`
+	AwsAccountName string   `json:"AwsAccountName"`
+	Region         string   `json:"Region"`
+	Types          []string `json:"Types"`
+	Title          string   `json:"Title"`
+	Description    string   `json:"Description"`
+	SourceUrl      string   `json:"SourceUrl"`
+
+	CreatedAt       string `json:"CreatedAt"`
+	UpdatedAt       string `json:"UpdatedAt"`
+	FirstObservedAt string `json:"FirstObservedAt"`
+	LastObservedAt  string `json:"LastObservedAt"`
+
+	Severity struct {
+		Label      string  `json:"Label"`
+		Normalized int64   `json:"Normalized"`
+		Original   string  `json:"Original"`
+		Product    float64 `json:"Product"`
+	} `json:"Severity"`
+	Compliance struct {
+		Status            string   `json:"Status"`
+		SecurityControlId string   `json:"SecurityControlId"`
+		RelatedReqs       []string `json:"RelatedRequirements"`
+	} `json:"Compliance"`
+	Workflow struct {
+		Status string `json:"Status"`
+	} `json:"Workflow"`
+	RecordState string `json:"RecordState"`
+	Remediation struct {
+		Recommendation struct {
+			Text string `json:"Text"`
+			Url  string `json:"Url"`
+		} `json:"Recommendation"`
+	} `json:"Remediation"`
+	Resources []Resource `json:"Resources"`
+}
+
+// Resource is an ASFF resource, the details are left out.
+type Resource struct {
+	Type      string            `json:"Type"`
+	Id        string            `json:"Id"`
+	Partition string            `json:"Partition"`
+	Region    string            `json:"Region"`
+	Tags      map[string]string `json:"Tags"`
+}
+
+// LogEntry is a flattened Security Hub finding, one per resource. Field names follow guarddutylogs.LogEntry where
+// they mean the same thing.
+type LogEntry struct {
+	Id          string `json:"id,omitempty"`
+	AccountId   string `json:"account_id,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	EventType   string `json:"event_type,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+	FirstSeen   string `json:"event_first_seen,omitempty"`
+	LastSeen    string `json:"event_last_seen,omitempty"`
+	SourceUrl   string `json:"source_url,omitempty"`
+
+	ProductArn  string `json:"product_arn,omitempty"`
+	ProductName string `json:"product_name,omitempty"`
+	CompanyName string `json:"company_name,omitempty"`
+	GeneratorId string `json:"generator_id,omitempty"`
+
+	Severity         float64 `json:"severity"`
+	SeverityLabel    string  `json:"severity_label,omitempty"`
+	SeverityOriginal string  `json:"severity_original,omitempty"`
+
+	ComplianceStatus  string   `json:"compliance_status,omitempty"`
+	SecurityControlId string   `json:"security_control_id,omitempty"`
+	Requirements      []string `json:"compliance_requirements,omitempty"`
+	WorkflowStatus    string   `json:"workflow_status,omitempty"`
+	RecordState       string   `json:"record_state,omitempty"`
+	Remediation       string   `json:"remediation,omitempty"`
+	RemediationUrl    string   `json:"remediation_url,omitempty"`
+
+	ResourceType      string            `json:"resource_type,omitempty"`
+	ResourceId        string            `json:"resource_id,omitempty"`
+	ResourcePartition string            `json:"resource_partition,omitempty"`
+	ResourceRegion    string            `json:"resource_region,omitempty"`
+	ResourceTags      map[string]string `json:"resource_tags,omitempty"`
+}
+
+// Flatten returns a LogEntry for each resource in the finding, or a single entry if there are none.
+func (f Finding) Flatten() []LogEntry {
+	base := LogEntry{
+		Id:                f.Id,
+		AccountId:         f.AwsAccountId,
+		AccountName:       f.AwsAccountName,
+		Region:            f.Region,
+		Title:             f.Title,
+		Description:       f.Description,
+		EventType:         strings.Join(f.Types, ","),
+		CreatedAt:         f.CreatedAt,
+		UpdatedAt:         f.UpdatedAt,
+		FirstSeen:         f.FirstObservedAt,
+		LastSeen:          f.LastObservedAt,
+		SourceUrl:         f.SourceUrl,
+		ProductArn:        f.ProductArn,
+		ProductName:       f.ProductName,
+		CompanyName:       f.CompanyName,
+		GeneratorId:       f.GeneratorId,
+		Severity:          float64(f.Severity.Normalized),
+		SeverityLabel:     f.Severity.Label,
+		SeverityOriginal:  f.Severity.Original,
+		ComplianceStatus:  f.Compliance.Status,
+		SecurityControlId: f.Compliance.SecurityControlId,
+		Requirements:      f.Compliance.RelatedReqs,
+		WorkflowStatus:    f.Workflow.Status,
+		RecordState:       f.RecordState,
+		Remediation:       f.Remediation.Recommendation.Text,
+		RemediationUrl:    f.Remediation.Recommendation.Url,
+	}
+	// older findings only have a product specific severity
+	if base.Severity == 0 && f.Severity.Product != 0 {
+		base.Severity = f.Severity.Product
+	}
+	// the ProductArn looks like arn:aws:securityhub:us-east-1::product/aws/inspector
+	if base.ProductName == "" {
+		if i := strings.LastIndex(f.ProductArn, "/"); i >= 0 {
+			base.ProductName = f.ProductArn[i+1:]
+		}
+	}
+	if len(f.Resources) == 0 {
+		return []LogEntry{base}
+	}
+	logs := make([]LogEntry, 0, len(f.Resources))
+	for _, r := range f.Resources {
+		l := base
+		l.ResourceType = r.Type
+		l.ResourceId = r.Id
+		l.ResourcePartition = r.Partition
+		l.ResourceRegion = r.Region
+		l.ResourceTags = r.Tags
+		if l.Region == "" {
+			l.Region = r.Region
+		}
+		logs = append(logs, l)
+	}
+	return logs
+}
+
+// ParseEvent decodes the findings in the detail of a "Security Hub Findings - Imported" (or Custom Action) event.
+func ParseEvent(detail json.RawMessage) ([]Finding, error) {
+	ev := struct {
+		Findings []Finding `json:"findings"`
+	}{}
+	if err := json.Unmarshal(detail, &ev); err != nil {
+		return nil, err
+	}
+	if len(ev.Findings) == 0 {
+		return nil, errors.New("event has no findings")
+	}
+	return ev.Findings, nil
+}
+
+// FromSDK converts a finding returned by GetFindings, the SDK uses the ASFF names so it can roundtrip through json.
+func FromSDK(f *securityhub.AwsSecurityFinding) (Finding, error) {
+	finding := Finding{}
+	if f == nil {
+		return finding, errors.New("finding is nil")
+	}
+	j, err := json.Marshal(f)
+	if err != nil {
+		return finding, err
+	}
+	err = json.Unmarshal(j, &finding)
+	return finding, err
+}
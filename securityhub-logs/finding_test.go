@@ -0,0 +1,111 @@
+package securityhublogs
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/securityhub/securityhubiface"
+	"testing"
+	"time"
+)
+
+// an Inspector vulnerability on one instance, and a Config rule failing on two buckets
+var rawEvents = []string{
+	`{"version":"0","id":"8e5622f9-d81c-4d81-612a-9319e7ee2506","detail-type":"Security Hub Findings - Imported","source":"aws.securityhub","account":"112233445566","time":"2023-05-01T10:06:30Z","region":"us-east-1","resources":["arn:aws:securityhub:us-east-1::product/aws/inspector/arn:aws:inspector2:us-east-1:112233445566:finding/abcd"],"detail":{"findings":[{"SchemaVersion":"2018-10-08","Id":"arn:aws:inspector2:us-east-1:112233445566:finding/abcd","ProductArn":"arn:aws:securityhub:us-east-1::product/aws/inspector","ProductName":"Inspector","CompanyName":"Amazon","Region":"us-east-1","GeneratorId":"AWSInspector","AwsAccountId":"112233445566","Types":["Software and Configuration Checks/Vulnerabilities/CVE"],"FirstObservedAt":"2023-04-30T10:00:00Z","LastObservedAt":"2023-05-01T10:00:00Z","CreatedAt":"2023-04-30T10:00:00Z","UpdatedAt":"2023-05-01T10:06:00Z","Severity":{"Label":"HIGH","Normalized":70,"Original":"HIGH"},"Title":"CVE-2023-0001 - openssl","Description":"A flaw in openssl.","Remediation":{"Recommendation":{"Text":"Upgrade openssl."}},"Resources":[{"Type":"AwsEc2Instance","Id":"arn:aws:ec2:us-east-1:112233445566:instance/i-0123456789abcdef0","Partition":"aws","Region":"us-east-1","Tags":{"Name":"web"},"Details":{"AwsEc2Instance":{"Type":"t3.small","ImageId":"ami-0123"}}}],"Vulnerabilities":[{"Id":"CVE-2023-0001","VulnerablePackages":[{"Name":"openssl","Version":"1.1.1"}]}],"WorkflowState":"NEW","Workflow":{"Status":"NEW"},"RecordState":"ACTIVE"}]}}`,
+	`{"version":"0","id":"8e5622f9-d81c-4d81-612a-9319e7ee2507","detail-type":"Security Hub Findings - Imported","source":"aws.securityhub","account":"112233445566","time":"2023-05-01T10:06:30Z","region":"us-east-1","resources":[],"detail":{"findings":[{"SchemaVersion":"2018-10-08","Id":"arn:aws:securityhub:us-east-1:112233445566:security-control/S3.8/finding/efgh","ProductArn":"arn:aws:securityhub:us-east-1::product/aws/securityhub","GeneratorId":"security-control/S3.8","AwsAccountId":"112233445566","Types":["Software and Configuration Checks/Industry and Regulatory Standards"],"CreatedAt":"2023-04-01T00:00:00Z","UpdatedAt":"2023-05-01T10:06:00Z","Severity":{"Label":"HIGH","Normalized":70,"Original":"HIGH"},"Title":"S3 general purpose buckets should block public access","Description":"This control checks whether an S3 bucket blocks public access.","Remediation":{"Recommendation":{"Text":"For information on how to correct this issue, consult the AWS Security Hub controls documentation.","Url":"https://docs.aws.amazon.com/console/securityhub/S3.8/remediation"}},"Resources":[{"Type":"AwsS3Bucket","Id":"arn:aws:s3:::public-one","Partition":"aws","Region":"us-east-1"},{"Type":"AwsS3Bucket","Id":"arn:aws:s3:::public-two","Partition":"aws","Region":"us-east-1","Details":{"Other":{"weird":"value"}}}],"Compliance":{"Status":"FAILED","SecurityControlId":"S3.8","RelatedRequirements":["NIST.800-53.r5 AC-21"]},"Workflow":{"Status":"NEW"},"RecordState":"ACTIVE"}]}}`,
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		logs  int
+		check func(l LogEntry) bool
+	}{
+		{1, func(l LogEntry) bool {
+			return l.ProductName == "Inspector" && l.SeverityLabel == "HIGH" && l.Severity == 70 && l.AccountId == "112233445566" &&
+				l.Region == "us-east-1" && l.ResourceType == "AwsEc2Instance" && l.ResourceTags["Name"] == "web" && l.WorkflowStatus == "NEW"
+		}},
+		{2, func(l LogEntry) bool {
+			return l.ProductName == "securityhub" && l.ComplianceStatus == "FAILED" && l.SecurityControlId == "S3.8" &&
+				l.ResourceId == "arn:aws:s3:::public-one" && l.Region == "us-east-1"
+		}},
+	}
+	for i, rawEvent := range rawEvents {
+		cwEvent := &events.CloudWatchEvent{}
+		if err := json.Unmarshal([]byte(rawEvent), cwEvent); err != nil {
+			t.Fatal(err)
+		}
+		findings, err := ParseEvent(cwEvent.Detail)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs := findings[0].Flatten()
+		if len(logs) != tests[i].logs {
+			t.Errorf("event %d: expected %d logs, got %d", i, tests[i].logs, len(logs))
+			continue
+		}
+		if !tests[i].check(logs[0]) {
+			t.Errorf("event %d: unexpected log entry %+v", i, logs[0])
+		}
+	}
+
+	if _, err := ParseEvent(json.RawMessage(`{}`)); err == nil {
+		t.Error("expected an error for an event without findings")
+	}
+}
+
+type fakeSecurityHub struct {
+	securityhubiface.SecurityHubAPI
+	input *securityhub.GetFindingsInput
+}
+
+func (f *fakeSecurityHub) GetFindingsPages(in *securityhub.GetFindingsInput, fn func(*securityhub.GetFindingsOutput, bool) bool) error {
+	f.input = in
+	fn(&securityhub.GetFindingsOutput{Findings: []*securityhub.AwsSecurityFinding{
+		{Id: aws.String("a"), UpdatedAt: aws.String("2023-05-01T10:00:00.000Z"), Resources: []*securityhub.Resource{{Type: aws.String("AwsIamRole"), Id: aws.String("role")}}},
+		nil,
+	}}, false)
+	fn(&securityhub.GetFindingsOutput{Findings: []*securityhub.AwsSecurityFinding{
+		{Id: aws.String("b"), UpdatedAt: aws.String("2023-05-01T11:00:00.000Z")},
+	}}, true)
+	return nil
+}
+
+func TestPollerCollect(t *testing.T) {
+	svc := &fakeSecurityHub{}
+	ids := make([]string, 0)
+	since := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	last, err := NewPoller(svc).Collect(UpdatedSince(since), Position{UpdatedAt: since}, func(f Finding) error {
+		ids = append(ids, f.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("unexpected findings %v", ids)
+	}
+	if !last.UpdatedAt.Equal(since.Add(11*time.Hour)) || len(last.Ids) != 1 || last.Ids[0] != "b" {
+		t.Errorf("unexpected checkpoint %v", last)
+	}
+	if aws.StringValue(svc.input.Filters.UpdatedAt[0].Start) != "2023-05-01T00:00:00Z" || svc.input.Filters.RecordState != nil {
+		t.Errorf("unexpected filter %v", svc.input.Filters)
+	}
+}
+
+func TestPollerCollectSkipsCollected(t *testing.T) {
+	svc := &fakeSecurityHub{}
+	// a was collected at 10:00 by the last poll, b is newer
+	pos := Position{UpdatedAt: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), Ids: []string{"a"}}
+	ids := make([]string, 0)
+	last, err := NewPoller(svc).Collect(UpdatedSince(pos.UpdatedAt), pos, func(f Finding) error {
+		ids = append(ids, f.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "b" || last.Ids[0] != "b" {
+		t.Errorf("expected only b, got %v with position %+v", ids, last)
+	}
+}
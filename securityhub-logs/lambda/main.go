@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	securityhublogs "github.com/blockpane/logsuck/securityhub-logs"
+	"log"
+	"os"
+	"time"
+)
+
+// MODE selects how findings are collected: event (the default) is triggered by an EventBridge rule for
+// "Security Hub Findings - Imported", poll runs on a schedule and fetches findings updated since the checkpoint, and
+// backfill is run once to fetch every active finding and set the checkpoint for poll mode.
+func main() {
+	switch os.Getenv("MODE") {
+	case "poll":
+		lambda.Start(HandlePoll)
+	case "backfill":
+		lambda.Start(HandleBackfill)
+	default:
+		lambda.Start(HandleRequest)
+	}
+}
+
+func HandleRequest(ctx context.Context, event events.CloudWatchEvent) (msg string, err error) {
+	findings, err := securityhublogs.ParseEvent(event.Detail)
+	if err != nil {
+		return "couldn't decode findings", err
+	}
+	for _, f := range findings {
+		printFinding(f)
+	}
+	return "", nil
+}
+
+// HandlePoll prints findings updated since the last run.
+func HandlePoll() error {
+	return poll(func(cp *securityhublogs.Checkpoint) (*securityhub.AwsSecurityFindingFilters, securityhublogs.Position, error) {
+		pos, err := cp.Load()
+		if err != nil {
+			return nil, pos, err
+		}
+		if pos.UpdatedAt.IsZero() {
+			log.Println("warning: no checkpoint found, starting from now. Use MODE=backfill to fetch existing findings.")
+			pos.UpdatedAt = time.Now().UTC()
+		}
+		log.Println("fetching findings updated since", pos.UpdatedAt.Format(time.RFC3339))
+		return securityhublogs.UpdatedSince(pos.UpdatedAt), pos, nil
+	})
+}
+
+// HandleBackfill prints every active finding.
+func HandleBackfill() error {
+	return poll(func(cp *securityhublogs.Checkpoint) (*securityhub.AwsSecurityFindingFilters, securityhublogs.Position, error) {
+		log.Println("backfilling all active findings")
+		return securityhublogs.Active(), securityhublogs.Position{}, nil
+	})
+}
+
+// poll collects the findings matching the filters that weren't already collected at the position, and saves the new
+// position as the checkpoint, even if there was an error part way through.
+func poll(filters func(*securityhublogs.Checkpoint) (*securityhub.AwsSecurityFindingFilters, securityhublogs.Position, error)) error {
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	param := os.Getenv("SSM_TIMESTAMP")
+	if param == "" {
+		param = "/securityhub/timestamp"
+	}
+	cp := securityhublogs.NewCheckpoint(ssm.New(sess), param)
+	f, pos, err := filters(cp)
+	if err != nil {
+		return err
+	}
+	last, err := securityhublogs.NewPoller(securityhub.New(sess)).Collect(f, pos, func(f securityhublogs.Finding) error {
+		printFinding(f)
+		return nil
+	})
+	if !last.UpdatedAt.IsZero() {
+		if e := cp.Save(last); e != nil {
+			log.Println("could not save checkpoint:", e)
+		}
+	}
+	return err
+}
+
+func printFinding(f securityhublogs.Finding) {
+	for _, l := range f.Flatten() {
+		j, _ := json.Marshal(l)
+		fmt.Println(string(j))
+	}
+}
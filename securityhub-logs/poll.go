@@ -0,0 +1,80 @@
+package securityhublogs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/securityhub"
+	"github.com/aws/aws-sdk-go/service/securityhub/securityhubiface"
+	"log"
+	"time"
+)
+
+// Poller fetches findings with the Security Hub API.
+type Poller struct {
+	SecurityHub securityhubiface.SecurityHubAPI
+}
+
+// NewPoller returns a Poller using the client.
+func NewPoller(svc securityhubiface.SecurityHubAPI) *Poller {
+	return &Poller{SecurityHub: svc}
+}
+
+// UpdatedSince returns filters matching findings updated at or after t, including ones that were archived or
+// resolved since, so those changes are logged too. The findings updated at t that were already collected come back
+// again, pass the Position to Collect to skip them.
+func UpdatedSince(t time.Time) *securityhub.AwsSecurityFindingFilters {
+	return &securityhub.AwsSecurityFindingFilters{
+		UpdatedAt: []*securityhub.DateFilter{{
+			Start: aws.String(t.UTC().Format(time.RFC3339Nano)),
+			End:   aws.String(time.Now().UTC().Format(time.RFC3339Nano)),
+		}},
+	}
+}
+
+// Active returns filters matching every finding that hasn't been archived.
+func Active() *securityhub.AwsSecurityFindingFilters {
+	return &securityhub.AwsSecurityFindingFilters{
+		RecordState: []*securityhub.StringFilter{{
+			Comparison: aws.String(securityhub.StringFilterComparisonEquals),
+			Value:      aws.String(securityhub.RecordStateActive),
+		}},
+	}
+}
+
+// Collect pages through the findings matching filters, oldest update first, and calls emit with each one that wasn't
+// already collected at pos. It returns the new position, which is still valid if an error is also returned.
+func (p *Poller) Collect(filters *securityhub.AwsSecurityFindingFilters, pos Position, emit func(Finding) error) (last Position, err error) {
+	last = pos
+	input := &securityhub.GetFindingsInput{
+		Filters:    filters,
+		MaxResults: aws.Int64(100),
+		SortCriteria: []*securityhub.SortCriterion{{
+			Field:     aws.String("UpdatedAt"),
+			SortOrder: aws.String(securityhub.SortOrderAsc),
+		}},
+	}
+	var emitErr error
+	err = p.SecurityHub.GetFindingsPages(input, func(out *securityhub.GetFindingsOutput, lastPage bool) bool {
+		for _, sf := range out.Findings {
+			f, e := FromSDK(sf)
+			if e != nil {
+				log.Println("skipping finding:", e)
+				continue
+			}
+			updated, e := time.Parse(time.RFC3339Nano, f.UpdatedAt)
+			if e == nil && pos.collected(updated, f.Id) {
+				continue
+			}
+			if emitErr = emit(f); emitErr != nil {
+				return false
+			}
+			if e == nil {
+				last.add(updated, f.Id)
+			}
+		}
+		return true
+	})
+	if emitErr != nil {
+		err = emitErr
+	}
+	return
+}
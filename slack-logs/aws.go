@@ -2,18 +2,39 @@ package slacklogs
 
 import (
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
 	"log"
 	"os"
 	"strconv"
 	"time"
 )
 
-// GetTokenSSM retrieves a saved auth Token from AWS SSM/Parameter store.
-func GetSSMValues() (secret string, last time.Time, err error) {
-	tokenParam, err := paramStore.GetParameter(
+// ParamStore reads the API token from, and keeps the last timestamp in, SSM parameter store.
+type ParamStore struct {
+	SSM     ssmiface.SSMAPI
+	Details AwsDetails
+}
+
+// NewParamStore returns a ParamStore for the details' region.
+func NewParamStore(details AwsDetails) (*ParamStore, error) {
+	awsSession, err := session.NewSession(
+		&aws.Config{
+			Region: aws.String(details.Region),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ParamStore{SSM: ssm.New(awsSession), Details: details}, nil
+}
+
+// GetSSMValues retrieves the saved auth token and last timestamp from AWS SSM/Parameter store.
+func (p *ParamStore) GetSSMValues() (secret string, last time.Time, err error) {
+	tokenParam, err := p.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name:           aws.String(awsDetails.TokenParameter),
+			Name:           aws.String(p.Details.TokenParameter),
 			WithDecryption: aws.Bool(true),
 		},
 	)
@@ -21,9 +42,9 @@ func GetSSMValues() (secret string, last time.Time, err error) {
 		return
 	}
 	secret = aws.StringValue(tokenParam.Parameter.Value)
-	timeParam, err := paramStore.GetParameter(
+	timeParam, err := p.SSM.GetParameter(
 		&ssm.GetParameterInput{
-			Name: aws.String(awsDetails.TimeParameter),
+			Name: aws.String(p.Details.TimeParameter),
 		},
 	)
 	if err != nil {
@@ -39,11 +60,11 @@ func GetSSMValues() (secret string, last time.Time, err error) {
 }
 
 // SaveTime persists the timestamp to parameter store after an update
-func SaveTime(t int64) (msg string, err error) {
-	_, err = paramStore.PutParameter(
+func (p *ParamStore) SaveTime(t int64) (msg string, err error) {
+	_, err = p.SSM.PutParameter(
 		&ssm.PutParameterInput{
 			Description: aws.String(`slack lastest log timestamp`),
-			Name:        aws.String(awsDetails.TimeParameter),
+			Name:        aws.String(p.Details.TimeParameter),
 			Overwrite:   aws.Bool(true),
 			Type:        aws.String(`String`),
 			Value:       aws.String(strconv.Itoa(int(t))),
@@ -62,7 +83,8 @@ type AwsDetails struct {
 	TimeParameter  string `json:"time_parameter"`
 }
 
-// NewAwsDetails reads environment variables, and if missing returns sensible defaults.
+// NewAwsDetails reads environment variables, and if missing returns sensible defaults. It's only called by the Lambda,
+// importing the package doesn't read anything from the environment.
 func NewAwsDetails() AwsDetails {
 	details := AwsDetails{
 		Region:         os.Getenv(`REGION`),
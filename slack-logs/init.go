@@ -1,11 +1,7 @@
 package slacklogs
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ssm"
 	"net"
-	"net/http"
 	"time"
 )
 
@@ -15,26 +11,6 @@ const (
 	RATELIMITWAITSEC = 30
 )
 
-var (
-	//Token     string
-	Req       = NewRequest()
-	Transport = &http.Transport{
-		ResponseHeaderTimeout: time.Second * 15,
-		DisableKeepAlives:     true,
-	}
-	awsDetails = NewAwsDetails()
-	awsSession = session.Must(
-		session.NewSession(
-			&aws.Config{
-				Region: aws.String(awsDetails.Region),
-			},
-		),
-	)
-	paramStore = ssm.New(awsSession, aws.NewConfig().WithRegion(awsDetails.Region))
-	Token      string
-	Last       time.Time
-)
-
 type Request struct {
 	Token  string `json:"token"`
 	Before int64  `json:"before"`
@@ -61,6 +37,7 @@ type AccessLog struct {
 	DateLast  int    `json:"date_last"`
 	Count     int    `json:"count"`
 	IP        net.IP `json:"ip"`
+	IPVersion int    `json:"ip_version,omitempty"`
 	UserAgent string `json:"user_agent"`
 	ISP       string `json:"isp"`
 	Country   string `json:"country"`
@@ -15,17 +15,26 @@ func main() {
 
 func handler() error {
 	newestLogin := int64(0)
-	var err error
-	slacklogs.Token, slacklogs.Last, err = slacklogs.GetSSMValues()
+	store, err := slacklogs.NewParamStore(slacklogs.NewAwsDetails())
+	if err != nil {
+		log.Printf("Could not create AWS session: %v\n", err)
+		return err
+	}
+	token, last, err := store.GetSSMValues()
 	if err != nil {
 		log.Printf("Could not get SSM parameters: %v\n", err)
 		return err
 	}
+	client, err := slacklogs.NewClient(token)
+	if err != nil {
+		return err
+	}
+	req := slacklogs.NewRequest()
 	var done bool
-	log.Println("looking for logs after:", slacklogs.Last.Unix())
+	log.Println("looking for logs after:", last.Unix())
 outer:
 	for {
-		resp, err := slacklogs.GetLogs(slacklogs.Req)
+		resp, err := client.GetLogs(req)
 		if err != nil {
 			j, _ := json.MarshalIndent(resp, "", "  ")
 			fmt.Println(string(j))
@@ -37,7 +46,7 @@ outer:
 			if int64(login.DateLast) > newestLogin {
 				newestLogin = int64(login.DateLast)
 			}
-			if int64(login.DateLast) <= slacklogs.Last.Unix() {
+			if int64(login.DateLast) <= last.Unix() {
 				fmt.Println("Found dup timestamp, all done.")
 				done = true
 				break outer
@@ -50,15 +59,15 @@ outer:
 			}
 		}
 
-		if slacklogs.Req.Page >= resp.Paging.Pages || done {
+		if req.Page >= resp.Paging.Pages || done {
 			break
 		}
-		slacklogs.Req.Next()
+		req.Next()
 	}
 	log.Println("saving updated ts:", newestLogin)
-	if msg, err := slacklogs.SaveTime(newestLogin); err != nil {
+	if msg, err := store.SaveTime(newestLogin); err != nil {
 		log.Printf("%s %v", msg, err)
-		log.Fatal("Exiting. Could not update timestamp in SSM.")
+		return err
 	}
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/blockpane/logsuck/internal/ipaddr"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"log"
@@ -11,23 +12,48 @@ import (
 	"time"
 )
 
-func GetLogs(slackRequest Request) (Response, error) {
+// Client calls the slack access logs API. Endpoint and Transport can be replaced, for example to point at a test
+// server.
+type Client struct {
+	Endpoint  string
+	Transport *http.Transport
+
+	token string
+}
+
+// NewClient returns a Client using the API token.
+func NewClient(token string) (*Client, error) {
+	if token == "" {
+		return nil, errors.New("no slack API token set")
+	}
+	return &Client{
+		Endpoint: ENDPOINT,
+		Transport: &http.Transport{
+			ResponseHeaderTimeout: time.Second * 15,
+			DisableKeepAlives:     true,
+		},
+		token: token,
+	}, nil
+}
+
+// GetLogs fetches one page of access logs.
+func (c *Client) GetLogs(slackRequest Request) (Response, error) {
 	SlackResponse := Response{}
 	body := []byte(fmt.Sprintf(
 		`token=%s&before=%d&count=%d&page=%d`,
-		Token,
+		c.token,
 		slackRequest.Before,
 		slackRequest.Count,
 		slackRequest.Page,
 	))
-	req, err := http.NewRequest("POST", ENDPOINT, bytes.NewBuffer(body))
+	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return SlackResponse, err
 	}
 	//req.Header.Set("Authorization", "Bearer "+Token)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Close = true
-	resp, err := Transport.RoundTrip(req)
+	resp, err := c.Transport.RoundTrip(req)
 	defer req.Body.Close()
 	if err != nil {
 		return SlackResponse, err
@@ -53,7 +79,10 @@ func GetLogs(slackRequest Request) (Response, error) {
 	if len(SlackResponse.Logins) == 0 {
 		return SlackResponse, errors.New("no results found")
 	}
-	Transport.CloseIdleConnections()
+	for i := range SlackResponse.Logins {
+		SlackResponse.Logins[i].IPVersion = ipaddr.Version(SlackResponse.Logins[i].IP)
+	}
+	c.Transport.CloseIdleConnections()
 	time.Sleep(time.Duration(RATELIMITMS))
 	return SlackResponse, nil
 }